@@ -0,0 +1,234 @@
+package nut
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// BatteryPacks returns the number of battery packs (battery.packs) and how many of them have failed (battery.packs.bad).
+// If the UPS does not report battery.packs, ErrVarNotSupported is returned. A missing battery.packs.bad is treated as zero.
+//
+// Combine this with the "RB" (replace battery) flag of ups.status for a fuller picture of battery health.
+func (u *UPS) BatteryPacks() (total int, bad int, err error) {
+	packs, err := u.getFloatVariable("battery.packs")
+	if err != nil {
+		return 0, 0, err
+	}
+	badPacks, err := u.getFloatVariable("battery.packs.bad")
+	if err == ErrVarNotSupported {
+		return int(packs), 0, nil
+	}
+	if err != nil {
+		return int(packs), 0, err
+	}
+	return int(packs), int(badPacks), nil
+}
+
+// RuntimeLowThreshold returns battery.runtime.low, the remaining runtime at which the UPS reports low battery and upsmon begins shutdown.
+// If the UPS does not report battery.runtime.low, ErrVarNotSupported is returned.
+func (u *UPS) RuntimeLowThreshold() (time.Duration, error) {
+	seconds, err := u.getFloatVariable("battery.runtime.low")
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// IsBelowRuntimeLow reports whether the remaining runtime (battery.runtime) is below battery.runtime.low.
+// If either variable is missing, ErrVarNotSupported is returned.
+func (u *UPS) IsBelowRuntimeLow() (bool, error) {
+	threshold, err := u.RuntimeLowThreshold()
+	if err != nil {
+		return false, err
+	}
+	runtime, err := u.getFloatVariable("battery.runtime")
+	if err != nil {
+		return false, err
+	}
+	return time.Duration(runtime*float64(time.Second)) < threshold, nil
+}
+
+// ProjectedRuntime estimates the remaining runtime if the load changed to assumedLoadPct percent, by scaling battery.runtime by ups.load / assumedLoadPct.
+// This simple model assumes runtime is inversely proportional to load. Real batteries deliver proportionally less at high loads (Peukert's law),
+// so the result is only an estimate and is optimistic when projecting to a higher load.
+// If either variable is missing, ErrVarNotSupported is returned. An error is also returned if assumedLoadPct or the current load is not positive.
+func (u *UPS) ProjectedRuntime(assumedLoadPct float64) (time.Duration, error) {
+	if assumedLoadPct <= 0 {
+		return 0, fmt.Errorf("invalid assumed load %v%%: must be positive", assumedLoadPct)
+	}
+	runtime, err := u.getFloatVariable("battery.runtime")
+	if err != nil {
+		return 0, err
+	}
+	load, err := u.getFloatVariable("ups.load")
+	if err != nil {
+		return 0, err
+	}
+	if load <= 0 {
+		return 0, fmt.Errorf("cannot project runtime for %s from a load of %v%%", u.Name, load)
+	}
+	return time.Duration(runtime * load / assumedLoadPct * float64(time.Second)), nil
+}
+
+// RestartChargeThreshold returns battery.charge.restart, the charge percentage the battery must reach before the UPS re-enables its output after a deep discharge.
+// If the UPS does not report battery.charge.restart, ErrVarNotSupported is returned.
+func (u *UPS) RestartChargeThreshold() (float64, error) {
+	return u.getFloatVariable("battery.charge.restart")
+}
+
+// IsChargeAboveRestart reports whether battery.charge has reached battery.charge.restart.
+// If either variable is missing, ErrVarNotSupported is returned.
+func (u *UPS) IsChargeAboveRestart() (bool, error) {
+	threshold, err := u.RestartChargeThreshold()
+	if err != nil {
+		return false, err
+	}
+	charge, err := u.getFloatVariable("battery.charge")
+	if err != nil {
+		return false, err
+	}
+	return charge >= threshold, nil
+}
+
+// batteryTestStopWindow is how long AbortBatteryTest waits for the test to stop when ctx has no earlier deadline.
+const batteryTestStopWindow = 10 * time.Second
+
+// batteryTestStopPollInterval is how often AbortBatteryTest polls ups.test.result while waiting for the test to stop.
+const batteryTestStopPollInterval = 250 * time.Millisecond
+
+// AbortBatteryTest stops a running battery test with the "test.battery.stop" instant command, then polls ups.test.result
+// until it no longer reports the test as in progress. An error is returned if the test is still running after a short window or when ctx expires.
+func (u *UPS) AbortBatteryTest(ctx context.Context) error {
+	ok, err := u.SendCommand("test.battery.stop")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("upsd did not accept test.battery.stop for %s", u.Name)
+	}
+	ctx, cancel := context.WithTimeout(ctx, batteryTestStopWindow)
+	defer cancel()
+	ticker := time.NewTicker(batteryTestStopPollInterval)
+	defer ticker.Stop()
+	for {
+		result, _, err := u.GetTestResult()
+		if err != nil {
+			return err
+		}
+		if result != TestResultInProgress {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("battery test on %s is still in progress after test.battery.stop: %w", u.Name, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// TestResult is the parsed outcome of a battery test, as reported by ups.test.result.
+type TestResult int
+
+// Known battery test results.
+const (
+	TestResultUnknown TestResult = iota
+	TestResultNone
+	TestResultInProgress
+	TestResultPassed
+	TestResultWarning
+	TestResultError
+	TestResultAborted
+)
+
+func (r TestResult) String() string {
+	switch r {
+	case TestResultNone:
+		return "No test initiated"
+	case TestResultInProgress:
+		return "In progress"
+	case TestResultPassed:
+		return "Done and passed"
+	case TestResultWarning:
+		return "Done and warning"
+	case TestResultError:
+		return "Done and error"
+	case TestResultAborted:
+		return "Aborted"
+	}
+	return "Unknown"
+}
+
+// terminal reports whether the result is final, i.e. no test is running and the result will not change by itself.
+func (r TestResult) terminal() bool {
+	switch r {
+	case TestResultNone, TestResultPassed, TestResultWarning, TestResultError, TestResultAborted:
+		return true
+	}
+	return false
+}
+
+// ParseTestResult maps a ups.test.result value to a TestResult.
+// Matching is case-insensitive and tolerates wording differences between drivers, e.g. "InProgress" or "Done and failed".
+func ParseTestResult(value string) TestResult {
+	normalized := strings.ToLower(value)
+	switch {
+	case strings.Contains(normalized, "progress"), strings.Contains(normalized, "running"):
+		return TestResultInProgress
+	case strings.Contains(normalized, "abort"):
+		return TestResultAborted
+	case strings.Contains(normalized, "no test"), strings.Contains(normalized, "not initiated"), normalized == "none":
+		return TestResultNone
+	case strings.Contains(normalized, "warn"):
+		return TestResultWarning
+	case strings.Contains(normalized, "error"), strings.Contains(normalized, "fail"):
+		return TestResultError
+	case strings.Contains(normalized, "pass"):
+		return TestResultPassed
+	}
+	return TestResultUnknown
+}
+
+// GetTestResult returns the parsed result of the last battery test along with the raw ups.test.result value, which is useful when the result is TestResultUnknown.
+func (u *UPS) GetTestResult() (TestResult, string, error) {
+	value, err := u.getVariableValue("ups.test.result")
+	if err != nil {
+		return TestResultUnknown, "", err
+	}
+	return ParseTestResult(value), value, nil
+}
+
+// WaitBatteryTest polls ups.test.result every interval until the battery test reaches a final result or ctx expires.
+// It returns the final result and its raw value. A non-positive interval is rejected with an error.
+//
+// Call it right after starting a test, e.g. with test.battery.start. The value read by the first poll may still be the result of an earlier test,
+// so a final result is only accepted once the test has been seen in progress or ups.test.result has changed from that first value.
+func (u *UPS) WaitBatteryTest(ctx context.Context, interval time.Duration) (TestResult, string, error) {
+	if err := validateInterval(interval); err != nil {
+		return TestResultUnknown, "", err
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	initial, started := "", false
+	for polls := 0; ; polls++ {
+		result, raw, err := u.GetTestResult()
+		if err != nil {
+			return result, raw, err
+		}
+		if polls == 0 {
+			initial = raw
+		}
+		if result == TestResultInProgress || raw != initial {
+			started = true
+		}
+		if started && result.terminal() {
+			return result, raw, nil
+		}
+		select {
+		case <-ctx.Done():
+			return result, raw, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
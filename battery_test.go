@@ -0,0 +1,234 @@
+package nut
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// batteryTestHook simulates a battery test that reports results from results, one per poll after test.battery.stop is received.
+func batteryTestHook(upsName string, results ...string) func(cmd string) ([]string, bool) {
+	stopped, polls := false, 0
+	return func(cmd string) ([]string, bool) {
+		switch cmd {
+		case "INSTCMD " + upsName + " test.battery.stop":
+			stopped = true
+			return []string{"OK"}, true
+		case "GET VAR " + upsName + " ups.test.result":
+			result := "In progress"
+			if stopped {
+				result = results[len(results)-1]
+				if polls < len(results) {
+					result = results[polls]
+				}
+				polls++
+			}
+			return []string{`VAR ` + upsName + ` ups.test.result "` + result + `"`}, true
+		}
+		return nil, false
+	}
+}
+
+func TestAbortBatteryTest(t *testing.T) {
+	server := newMockServer(t)
+	server.addUPS("ups", "", map[string]string{"ups.test.result": "In progress"})
+	server.hook = batteryTestHook("ups", "In progress", "Aborted")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := testUPS(server, "ups").AbortBatteryTest(ctx); err != nil {
+		t.Fatalf("AbortBatteryTest: %v", err)
+	}
+	received := server.commands()
+	if received[0] != "INSTCMD ups test.battery.stop" || len(received) != 3 {
+		t.Errorf("expected the stop command followed by two polls, got %q", received)
+	}
+}
+
+func TestAbortBatteryTestNeverStops(t *testing.T) {
+	server := newMockServer(t)
+	server.addUPS("ups", "", map[string]string{"ups.test.result": "In progress"})
+	server.hook = batteryTestHook("ups", "InProgress")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := testUPS(server, "ups").AbortBatteryTest(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected an error wrapping context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestBatteryPacks(t *testing.T) {
+	server := newMockServer(t)
+	server.addUPS("bank", "", map[string]string{"battery.packs": "4", "battery.packs.bad": "1"})
+	server.addUPS("single", "", map[string]string{"battery.charge": "100"})
+
+	total, bad, err := testUPS(server, "bank").BatteryPacks()
+	if err != nil {
+		t.Fatalf("BatteryPacks: %v", err)
+	}
+	if total != 4 || bad != 1 {
+		t.Errorf("expected 4 packs with 1 bad, got %d with %d bad", total, bad)
+	}
+
+	if _, _, err := testUPS(server, "single").BatteryPacks(); err != ErrVarNotSupported {
+		t.Errorf("expected ErrVarNotSupported, got %v", err)
+	}
+}
+
+func TestRuntimeLow(t *testing.T) {
+	server := newMockServer(t)
+	server.addUPS("below", "", map[string]string{"battery.runtime": "90", "battery.runtime.low": "120"})
+	server.addUPS("above", "", map[string]string{"battery.runtime": "1800", "battery.runtime.low": "120"})
+	server.addUPS("missing", "", map[string]string{"battery.runtime": "1800"})
+
+	threshold, err := testUPS(server, "below").RuntimeLowThreshold()
+	if err != nil || threshold != 2*time.Minute {
+		t.Fatalf("RuntimeLowThreshold: %v, %v", threshold, err)
+	}
+	for name, expected := range map[string]bool{"below": true, "above": false} {
+		below, err := testUPS(server, name).IsBelowRuntimeLow()
+		if err != nil {
+			t.Fatalf("IsBelowRuntimeLow(%s): %v", name, err)
+		}
+		if below != expected {
+			t.Errorf("%s: expected %v, got %v", name, expected, below)
+		}
+	}
+	if _, err := testUPS(server, "missing").IsBelowRuntimeLow(); err != ErrVarNotSupported {
+		t.Errorf("expected ErrVarNotSupported, got %v", err)
+	}
+}
+
+func TestParseTestResult(t *testing.T) {
+	cases := map[string]TestResult{
+		"Done and passed":     TestResultPassed,
+		"Done and warning":    TestResultWarning,
+		"Done and error":      TestResultError,
+		"Aborted":             TestResultAborted,
+		"In progress":         TestResultInProgress,
+		"No test initiated":   TestResultNone,
+		"DONE AND PASSED":     TestResultPassed,
+		"InProgress":          TestResultInProgress,
+		"Done and failed":     TestResultError,
+		"Test aborted":        TestResultAborted,
+		"Calibration pending": TestResultUnknown,
+	}
+	for value, expected := range cases {
+		if result := ParseTestResult(value); result != expected {
+			t.Errorf("%q: expected %v, got %v", value, expected, result)
+		}
+	}
+}
+
+func TestWaitBatteryTest(t *testing.T) {
+	server := newMockServer(t)
+	server.addUPS("ups", "", map[string]string{"ups.test.result": "In progress"})
+	polls := 0
+	server.hook = func(cmd string) ([]string, bool) {
+		if cmd != "GET VAR ups ups.test.result" {
+			return nil, false
+		}
+		polls++
+		if polls < 3 {
+			return []string{`VAR ups ups.test.result "In progress"`}, true
+		}
+		return []string{`VAR ups ups.test.result "Done and warning"`}, true
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	result, raw, err := testUPS(server, "ups").WaitBatteryTest(ctx, time.Millisecond)
+	if err != nil {
+		t.Fatalf("WaitBatteryTest: %v", err)
+	}
+	if result != TestResultWarning || raw != "Done and warning" {
+		t.Errorf("expected a warning result, got %v (%q)", result, raw)
+	}
+}
+
+func TestWaitBatteryTestIgnoresPreviousResult(t *testing.T) {
+	server := newMockServer(t)
+	server.addUPS("ups", "", map[string]string{"ups.test.result": "Done and passed"})
+	polls := 0
+	server.hook = func(cmd string) ([]string, bool) {
+		if cmd != "GET VAR ups ups.test.result" {
+			return nil, false
+		}
+		polls++
+		// The first polls still see the previous test's result, and the driver never reports the new test as in progress.
+		if polls < 3 {
+			return []string{`VAR ups ups.test.result "Done and passed"`}, true
+		}
+		return []string{`VAR ups ups.test.result "Done and error"`}, true
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	result, raw, err := testUPS(server, "ups").WaitBatteryTest(ctx, time.Millisecond)
+	if err != nil {
+		t.Fatalf("WaitBatteryTest: %v", err)
+	}
+	if result != TestResultError || raw != "Done and error" {
+		t.Errorf("expected the new test's result, not the stale one, got %v (%q)", result, raw)
+	}
+}
+
+func TestWaitBatteryTestRejectsInvalidInterval(t *testing.T) {
+	server := newMockServer(t)
+	server.addUPS("ups", "", map[string]string{"ups.test.result": "In progress"})
+
+	if _, _, err := testUPS(server, "ups").WaitBatteryTest(context.Background(), 0); err == nil {
+		t.Fatal("expected an error for a zero interval")
+	}
+	if len(server.commands()) != 0 {
+		t.Errorf("expected no polls, got %q", server.commands())
+	}
+}
+
+func TestRestartChargeThreshold(t *testing.T) {
+	server := newMockServer(t)
+	server.addUPS("below", "", map[string]string{"battery.charge": "12", "battery.charge.restart": "30"})
+	server.addUPS("above", "", map[string]string{"battery.charge": "45", "battery.charge.restart": "30"})
+	server.addUPS("missing", "", map[string]string{"battery.charge": "45"})
+
+	threshold, err := testUPS(server, "below").RestartChargeThreshold()
+	if err != nil || threshold != 30 {
+		t.Fatalf("RestartChargeThreshold: %v, %v", threshold, err)
+	}
+	for name, expected := range map[string]bool{"below": false, "above": true} {
+		above, err := testUPS(server, name).IsChargeAboveRestart()
+		if err != nil {
+			t.Fatalf("IsChargeAboveRestart(%s): %v", name, err)
+		}
+		if above != expected {
+			t.Errorf("%s: expected %v, got %v", name, expected, above)
+		}
+	}
+	if _, err := testUPS(server, "missing").IsChargeAboveRestart(); err != ErrVarNotSupported {
+		t.Errorf("expected ErrVarNotSupported, got %v", err)
+	}
+}
+
+func TestProjectedRuntime(t *testing.T) {
+	server := newMockServer(t)
+	server.addUPS("ups", "", map[string]string{"battery.runtime": "1200", "ups.load": "40"})
+	server.addUPS("idle", "", map[string]string{"battery.runtime": "3600", "ups.load": "0"})
+	server.addUPS("legacy", "", map[string]string{"battery.runtime": "1200"})
+	ups := testUPS(server, "ups")
+
+	for load, expected := range map[float64]time.Duration{80: 10 * time.Minute, 40: 20 * time.Minute, 20: 40 * time.Minute} {
+		if runtime, err := ups.ProjectedRuntime(load); err != nil || runtime != expected {
+			t.Errorf("at %v%%: expected %v, got %v, %v", load, expected, runtime, err)
+		}
+	}
+	if _, err := ups.ProjectedRuntime(0); err == nil {
+		t.Error("expected an error for an assumed load of zero")
+	}
+	if _, err := testUPS(server, "idle").ProjectedRuntime(50); err == nil {
+		t.Error("expected an error for a current load of zero")
+	}
+	if _, err := testUPS(server, "legacy").ProjectedRuntime(50); !errors.Is(err, ErrVarNotSupported) {
+		t.Errorf("expected ErrVarNotSupported without ups.load, got %v", err)
+	}
+}
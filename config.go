@@ -0,0 +1,77 @@
+package nut
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ExportConfig returns every writable (RW) variable of the UPS and its current value, as reported by LIST RW.
+// The result can be applied to the same or another UPS with ImportConfig.
+func (u *UPS) ExportConfig() (map[string]string, error) {
+	config := map[string]string{}
+	resp, err := u.nutClient.SendCommand(fmt.Sprintf("LIST RW %s", u.Name))
+	if err != nil {
+		return config, err
+	}
+	offset := fmt.Sprintf("RW %s ", u.Name)
+	for _, line := range resp[1 : len(resp)-1] {
+		name, value := parseVariableLine(strings.TrimPrefix(line, offset))
+		config[name] = value
+	}
+	return config, nil
+}
+
+// ImportConfig applies config, as returned by ExportConfig, to the UPS and returns the names of the variables that were SET.
+//
+// Variables which are not writable on this UPS, or whose current value already matches, are skipped.
+// Each value is validated against the variable's type (ENUM values and STRING length) before it is SET.
+// Variables are applied in name order and the first failure stops the import, returning the variables applied so far.
+func (u *UPS) ImportConfig(config map[string]string) (applied []string, err error) {
+	applied = []string{}
+	current, err := u.ExportConfig()
+	if err != nil {
+		return applied, err
+	}
+	names := []string{}
+	for name := range config {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := config[name]
+		currentValue, writeable := current[name]
+		if !writeable || currentValue == value {
+			continue
+		}
+		if err := u.validateValue(name, value); err != nil {
+			return applied, err
+		}
+		ok, err := u.SetVariable(name, value)
+		if err != nil {
+			return applied, fmt.Errorf("error setting %s: %w", name, err)
+		}
+		if !ok {
+			return applied, fmt.Errorf("upsd did not accept SET of %s", name)
+		}
+		applied = append(applied, name)
+	}
+	return applied, nil
+}
+
+// validateValue checks value against the type of the writable variable variableName.
+func (u *UPS) validateValue(variableName, value string) error {
+	varType, _, maximumLength, err := u.GetVariableType(variableName)
+	if err != nil {
+		return err
+	}
+	switch varType {
+	case "ENUM":
+		return u.validateEnum(variableName, value)
+	case "STRING":
+		if maximumLength > 0 && len(value) > maximumLength {
+			return fmt.Errorf("value for %s is %d characters long, the maximum is %d", variableName, len(value), maximumLength)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package nut
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExportImportConfig(t *testing.T) {
+	server := newMockServer(t)
+	source := server.addUPS("source", "", map[string]string{
+		"ups.delay.shutdown": "30",
+		"input.sensitivity":  "low",
+		"ups.id":             "rack-a",
+		"ups.status":         "OL",
+	})
+	source.types["ups.delay.shutdown"] = "RW STRING:10"
+	source.types["input.sensitivity"] = "RW ENUM"
+	source.types["ups.id"] = "RW STRING:8"
+	target := server.addUPS("target", "", map[string]string{
+		"ups.delay.shutdown": "20",
+		"input.sensitivity":  "normal",
+		"ups.id":             "rack-a",
+		"ups.status":         "OB",
+	})
+	target.types = source.types
+	target.enums["input.sensitivity"] = []string{"low", "normal", "high"}
+
+	config, err := testUPS(server, "source").ExportConfig()
+	if err != nil {
+		t.Fatalf("ExportConfig: %v", err)
+	}
+	if len(config) != 3 || config["ups.delay.shutdown"] != "30" {
+		t.Fatalf("expected only the RW variables, got %v", config)
+	}
+
+	// Read-only variables in the input are skipped, not SET.
+	config["ups.status"] = "OL"
+	ups := testUPS(server, "target")
+	applied, err := ups.ImportConfig(config)
+	if err != nil {
+		t.Fatalf("ImportConfig: %v", err)
+	}
+	if strings.Join(applied, ",") != "input.sensitivity,ups.delay.shutdown" {
+		t.Errorf("expected the two differing variables to be applied, got %v", applied)
+	}
+
+	applied, err = ups.ImportConfig(config)
+	if err != nil || len(applied) != 0 {
+		t.Errorf("expected re-import to be a no-op, got %v, %v", applied, err)
+	}
+}
+
+func TestImportConfigEscapesValues(t *testing.T) {
+	server := newMockServer(t)
+	mock := server.addUPS("ups", "", map[string]string{"ups.id": "rack-a", "ups.contacts": "ops"})
+	mock.types["ups.id"] = "RW STRING:32"
+	mock.types["ups.contacts"] = "RW STRING:32"
+	ups := testUPS(server, "ups")
+
+	// A value with a line break could end the SET early and smuggle in another command, so it is refused.
+	applied, err := ups.ImportConfig(map[string]string{"ups.id": "x\"\nFSD ups\n\""})
+	if err == nil || len(applied) != 0 {
+		t.Fatalf("expected a value with a line break to be refused, got %v, %v", applied, err)
+	}
+	for _, cmd := range server.commands() {
+		if strings.HasPrefix(cmd, "FSD") || strings.HasPrefix(cmd, "SET") {
+			t.Errorf("expected nothing to be sent for the refused value, got %q", cmd)
+		}
+	}
+
+	// Quotes and backslashes are escaped, so the value round-trips through ExportConfig.
+	value := `Rack "A" \ top`
+	if applied, err := ups.ImportConfig(map[string]string{"ups.contacts": value}); err != nil || len(applied) != 1 {
+		t.Fatalf("ImportConfig: %v, %v", applied, err)
+	}
+	config, err := ups.ExportConfig()
+	if err != nil || config["ups.contacts"] != value {
+		t.Fatalf("expected %q after export, got %q, %v", value, config["ups.contacts"], err)
+	}
+	if applied, err := ups.ImportConfig(config); err != nil || len(applied) != 0 {
+		t.Errorf("expected re-import to be a no-op, got %v, %v", applied, err)
+	}
+}
+
+func TestImportConfigValidation(t *testing.T) {
+	server := newMockServer(t)
+	mock := server.addUPS("ups", "", map[string]string{"ups.id": "a", "input.sensitivity": "normal"})
+	mock.types["ups.id"] = "RW STRING:4"
+	mock.types["input.sensitivity"] = "RW ENUM"
+	mock.enums["input.sensitivity"] = []string{"low", "normal", "high"}
+	ups := testUPS(server, "ups")
+
+	if _, err := ups.ImportConfig(map[string]string{"ups.id": "far-too-long"}); err == nil {
+		t.Error("expected an over-long STRING value to be rejected")
+	}
+	if _, err := ups.ImportConfig(map[string]string{"input.sensitivity": "extreme"}); err == nil {
+		t.Error("expected an invalid ENUM value to be rejected")
+	}
+	for _, cmd := range server.commands() {
+		if strings.HasPrefix(cmd, "SET ") {
+			t.Errorf("expected invalid values to be rejected locally, but sent %q", cmd)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package nut
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// FirmwareInfo describes the model, firmware and manufacture date of a UPS, as used for asset management.
+type FirmwareInfo struct {
+	Model       string
+	Firmware    string
+	FirmwareAux string
+	// ManufactureDate is the zero time if ups.mfr.date is missing or in an unrecognized format.
+	ManufactureDate time.Time
+	// RawManufactureDate is the unparsed value of ups.mfr.date.
+	RawManufactureDate string
+	// Type is the topology interpreted from ups.type, UPSTypeUnknown if it is missing or not recognized.
+	Type UPSType
+	// RawType is the unparsed value of ups.type.
+	RawType string
+}
+
+// manufactureDateLayouts are the ups.mfr.date formats reported by common drivers.
+var manufactureDateLayouts = []string{
+	"2006-01-02",
+	"2006/01/02",
+	"01/02/2006",
+	"01/02/06",
+	"02.01.2006",
+	"20060102",
+	"2006-01",
+}
+
+// GetFirmwareInfo returns the model (ups.model), firmware versions (ups.firmware, ups.firmware.aux), manufacture date (ups.mfr.date)
+// and topology (ups.type) of the UPS. Variables the UPS does not provide are left empty.
+func (u *UPS) GetFirmwareInfo() (FirmwareInfo, error) {
+	info := FirmwareInfo{}
+	fields := map[string]*string{
+		"ups.model":        &info.Model,
+		"ups.firmware":     &info.Firmware,
+		"ups.firmware.aux": &info.FirmwareAux,
+		"ups.mfr.date":     &info.RawManufactureDate,
+		"ups.type":         &info.RawType,
+	}
+	values, err := u.getVariableValues("ups.model", "ups.firmware", "ups.firmware.aux", "ups.mfr.date", "ups.type")
+	if err != nil {
+		return info, err
+	}
+	for variableName, field := range fields {
+		*field = values[variableName]
+	}
+	info.ManufactureDate = parseManufactureDate(info.RawManufactureDate)
+	info.Type = parseUPSType(info.RawType)
+	return info, nil
+}
+
+// parseManufactureDate returns the date in value, or the zero time if the format is not recognized.
+func parseManufactureDate(value string) time.Time {
+	value = strings.TrimSpace(value)
+	for _, layout := range manufactureDateLayouts {
+		parsed, err := time.Parse(layout, value)
+		if err == nil {
+			return parsed
+		}
+	}
+	return time.Time{}
+}
+
+// UPSType is the normalized topology of a UPS as reported by ups.type.
+type UPSType int
+
+// Known UPS topologies.
+const (
+	UPSTypeUnknown UPSType = iota
+	UPSTypeOffline
+	UPSTypeLineInteractive
+	UPSTypeOnline
+)
+
+func (t UPSType) String() string {
+	switch t {
+	case UPSTypeOffline:
+		return "offline"
+	case UPSTypeLineInteractive:
+		return "line-interactive"
+	case UPSTypeOnline:
+		return "online"
+	}
+	return "unknown"
+}
+
+// parseUPSType maps a ups.type value to a UPSType, ignoring case, spaces, dashes and underscores.
+func parseUPSType(value string) UPSType {
+	normalized := strings.ToLower(value)
+	for _, separator := range []string{" ", "-", "_", "/"} {
+		normalized = strings.Replace(normalized, separator, "", -1)
+	}
+	switch normalized {
+	case "offline", "standby", "offlinestandby":
+		return UPSTypeOffline
+	case "lineinteractive", "interactive":
+		return UPSTypeLineInteractive
+	case "online", "doubleconversion", "onlinedoubleconversion":
+		return UPSTypeOnline
+	}
+	return UPSTypeUnknown
+}
+
+// GetUPSType returns the topology of the UPS from ups.type, along with the raw value so that unknown types can still be displayed.
+// If the UPS does not report ups.type, ErrVarNotSupported is returned.
+func (u *UPS) GetUPSType() (UPSType, string, error) {
+	value, err := u.getVariableValue("ups.type")
+	if err != nil {
+		return UPSTypeUnknown, "", err
+	}
+	return parseUPSType(value), value, nil
+}
+
+// Instant commands used to control the hardware watchdog on UPSes which support one.
+const (
+	watchdogArmCommand    = "watchdog.arm"
+	watchdogDisarmCommand = "watchdog.disarm"
+)
+
+// WatchdogStatus returns the state of the hardware watchdog (ups.watchdog.status).
+// If the UPS has no watchdog, ErrVarNotSupported is returned.
+func (u *UPS) WatchdogStatus() (string, error) {
+	return u.getVariableValue("ups.watchdog.status")
+}
+
+// ArmWatchdog arms the hardware watchdog using the "watchdog.arm" instant command.
+// If the UPS does not list that command, ErrCmdNotSupported is returned without sending anything.
+func (u *UPS) ArmWatchdog() (bool, error) {
+	return u.sendSupportedCommand(watchdogArmCommand)
+}
+
+// DisarmWatchdog disarms the hardware watchdog using the "watchdog.disarm" instant command.
+// If the UPS does not list that command, ErrCmdNotSupported is returned without sending anything.
+func (u *UPS) DisarmWatchdog() (bool, error) {
+	return u.sendSupportedCommand(watchdogDisarmCommand)
+}
+
+// sendSupportedCommand sends commandName only if it is in the UPS's LIST CMD.
+func (u *UPS) sendSupportedCommand(commandName string) (bool, error) {
+	supported, err := u.supportsCommand(commandName)
+	if err != nil {
+		return false, err
+	}
+	if !supported {
+		return false, ErrCmdNotSupported
+	}
+	return u.SendCommand(commandName)
+}
+
+// supportsCommand reports whether commandName is in the UPS's LIST CMD, without fetching command descriptions.
+func (u *UPS) supportsCommand(commandName string) (bool, error) {
+	resp, err := u.nutClient.SendCommand(fmt.Sprintf("LIST CMD %s", u.Name))
+	if err != nil {
+		return false, err
+	}
+	for _, line := range resp[1 : len(resp)-1] {
+		if line == fmt.Sprintf("CMD %s %s", u.Name, commandName) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,104 @@
+package nut
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetFirmwareInfo(t *testing.T) {
+	server := newMockServer(t)
+	server.addUPS("known", "", map[string]string{
+		"ups.model":        "Smart-UPS 1500",
+		"ups.firmware":     "UPS 09.3",
+		"ups.firmware.aux": "ID18",
+		"ups.mfr.date":     "2019/06/21",
+		"ups.type":         "line-interactive",
+	})
+	server.addUPS("odd", "", map[string]string{"ups.mfr.date": "week 25 of 2019"})
+
+	info, err := testUPS(server, "known").GetFirmwareInfo()
+	if err != nil {
+		t.Fatalf("GetFirmwareInfo: %v", err)
+	}
+	if info.Model != "Smart-UPS 1500" || info.Firmware != "UPS 09.3" || info.FirmwareAux != "ID18" {
+		t.Errorf("unexpected firmware info: %+v", info)
+	}
+	if !info.ManufactureDate.Equal(time.Date(2019, 6, 21, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected manufacture date 2019-06-21, got %v", info.ManufactureDate)
+	}
+	if info.Type != UPSTypeLineInteractive || info.RawType != "line-interactive" {
+		t.Errorf("expected a line-interactive type, got %v (%q)", info.Type, info.RawType)
+	}
+
+	info, err = testUPS(server, "odd").GetFirmwareInfo()
+	if err != nil {
+		t.Fatalf("GetFirmwareInfo: %v", err)
+	}
+	if !info.ManufactureDate.IsZero() {
+		t.Errorf("expected zero manufacture date, got %v", info.ManufactureDate)
+	}
+	if info.RawManufactureDate != "week 25 of 2019" || info.Firmware != "" || info.Type != UPSTypeUnknown || info.RawType != "" {
+		t.Errorf("unexpected firmware info: %+v", info)
+	}
+}
+
+func TestGetUPSType(t *testing.T) {
+	cases := map[string]UPSType{
+		"offline":           UPSTypeOffline,
+		"Line Interactive":  UPSTypeLineInteractive,
+		"line-interactive":  UPSTypeLineInteractive,
+		"online":            UPSTypeOnline,
+		"Double Conversion": UPSTypeOnline,
+		"ferroresonant":     UPSTypeUnknown,
+	}
+	server := newMockServer(t)
+	for value := range cases {
+		server.addUPS(strings.Replace(value, " ", "", -1), "", map[string]string{"ups.type": value})
+	}
+	server.addUPS("none", "", nil)
+
+	for value, expected := range cases {
+		upsType, raw, err := testUPS(server, strings.Replace(value, " ", "", -1)).GetUPSType()
+		if err != nil {
+			t.Fatalf("GetUPSType(%q): %v", value, err)
+		}
+		if upsType != expected || raw != value {
+			t.Errorf("%q: expected %v, got %v (raw %q)", value, expected, upsType, raw)
+		}
+	}
+	if _, _, err := testUPS(server, "none").GetUPSType(); err != ErrVarNotSupported {
+		t.Errorf("expected ErrVarNotSupported, got %v", err)
+	}
+}
+
+func TestWatchdog(t *testing.T) {
+	server := newMockServer(t)
+	server.addUPS("guarded", "", map[string]string{"ups.watchdog.status": "disarmed"}).commands = []string{"watchdog.arm", "watchdog.disarm"}
+	server.addUPS("plain", "", nil).commands = []string{"beeper.toggle"}
+
+	guarded := testUPS(server, "guarded")
+	status, err := guarded.WatchdogStatus()
+	if err != nil || status != "disarmed" {
+		t.Fatalf("WatchdogStatus: %q, %v", status, err)
+	}
+	if ok, err := guarded.ArmWatchdog(); err != nil || !ok {
+		t.Errorf("ArmWatchdog: %v, %v", ok, err)
+	}
+	if ok, err := guarded.DisarmWatchdog(); err != nil || !ok {
+		t.Errorf("DisarmWatchdog: %v, %v", ok, err)
+	}
+
+	plain := testUPS(server, "plain")
+	if _, err := plain.WatchdogStatus(); err != ErrVarNotSupported {
+		t.Errorf("expected ErrVarNotSupported, got %v", err)
+	}
+	if _, err := plain.ArmWatchdog(); err != ErrCmdNotSupported {
+		t.Errorf("expected ErrCmdNotSupported, got %v", err)
+	}
+	for _, cmd := range server.commands() {
+		if cmd == "INSTCMD plain watchdog.arm" {
+			t.Errorf("expected unsupported command not to be sent")
+		}
+	}
+}
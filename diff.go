@@ -0,0 +1,164 @@
+package nut
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FieldChange describes a field or variable which differs between two UPS snapshots.
+// Old is nil for a variable that was added, and New is nil for one that was removed.
+type FieldChange struct {
+	Field string
+	Old   interface{}
+	New   interface{}
+}
+
+// DiffUPS compares two snapshots of a UPS, as returned by NewUPS or GetUPSList, and returns what changed.
+//
+// Description, NumberOfLogins and Master are compared first, followed by Variables in name order.
+// Numeric variables (INTEGER and FLOAT_64) whose values differ by no more than tolerance are not reported,
+// which suppresses noise such as small voltage fluctuations. Use a tolerance of 0 to report every change.
+func DiffUPS(a, b UPS, tolerance float64) []FieldChange {
+	changes := []FieldChange{}
+	if a.Description != b.Description {
+		changes = append(changes, FieldChange{"Description", a.Description, b.Description})
+	}
+	if a.NumberOfLogins != b.NumberOfLogins {
+		changes = append(changes, FieldChange{"NumberOfLogins", a.NumberOfLogins, b.NumberOfLogins})
+	}
+	if a.Master != b.Master {
+		changes = append(changes, FieldChange{"Master", a.Master, b.Master})
+	}
+
+	oldValues := map[string]interface{}{}
+	newValues := map[string]interface{}{}
+	names := []string{}
+	for _, v := range a.Variables {
+		oldValues[v.Name] = v.Value
+		names = append(names, v.Name)
+	}
+	for _, v := range b.Variables {
+		if _, ok := oldValues[v.Name]; !ok {
+			names = append(names, v.Name)
+		}
+		newValues[v.Name] = v.Value
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		oldValue, hadOld := oldValues[name]
+		newValue, hasNew := newValues[name]
+		switch {
+		case !hadOld:
+			changes = append(changes, FieldChange{name, nil, newValue})
+		case !hasNew:
+			changes = append(changes, FieldChange{name, oldValue, nil})
+		case !valuesEqual(oldValue, newValue, tolerance):
+			changes = append(changes, FieldChange{name, oldValue, newValue})
+		}
+	}
+	return changes
+}
+
+// UPSSummary is a snapshot of the key readings of a UPS, as returned by GetSummary. Readings the UPS does not report are left at zero.
+type UPSSummary struct {
+	Name   string
+	Status string
+	// BatteryCharge is battery.charge in percent.
+	BatteryCharge float64
+	// BatteryRuntime is battery.runtime in seconds.
+	BatteryRuntime float64
+	// InputVoltage is input.voltage in volts.
+	InputVoltage float64
+	// OutputVoltage is output.voltage in volts.
+	OutputVoltage float64
+	// Load is ups.load in percent.
+	Load float64
+}
+
+// GetSummary reads ups.status, battery.charge, battery.runtime, input.voltage, output.voltage and ups.load into a UPSSummary.
+func (u *UPS) GetSummary() (UPSSummary, error) {
+	summary := UPSSummary{Name: u.Name}
+	values, err := u.getVariableValues("ups.status", "battery.charge", "battery.runtime", "input.voltage", "output.voltage", "ups.load")
+	if err != nil {
+		return summary, err
+	}
+	summary.Status = values["ups.status"]
+	fields := map[string]*float64{
+		"battery.charge":  &summary.BatteryCharge,
+		"battery.runtime": &summary.BatteryRuntime,
+		"input.voltage":   &summary.InputVoltage,
+		"output.voltage":  &summary.OutputVoltage,
+		"ups.load":        &summary.Load,
+	}
+	for name, field := range fields {
+		value, ok := values[name]
+		if !ok {
+			continue
+		}
+		converted, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return summary, fmt.Errorf("invalid value %q for %s: %v", value, name, err)
+		}
+		*field = converted
+	}
+	return summary, nil
+}
+
+// DiffSummary compares two summaries and returns the fields that changed, in the order they are declared in UPSSummary.
+// The optional tolerance applies to the numeric fields: changes no larger than it are not reported, which suppresses noise
+// such as small voltage fluctuations. Without a tolerance every change is reported.
+func DiffSummary(a, b UPSSummary, tolerance ...float64) []FieldChange {
+	limit := 0.0
+	if len(tolerance) > 0 {
+		limit = tolerance[0]
+	}
+	changes := []FieldChange{}
+	if a.Name != b.Name {
+		changes = append(changes, FieldChange{"Name", a.Name, b.Name})
+	}
+	if a.Status != b.Status {
+		changes = append(changes, FieldChange{"Status", a.Status, b.Status})
+	}
+	for _, field := range []struct {
+		name     string
+		old, new float64
+	}{
+		{"BatteryCharge", a.BatteryCharge, b.BatteryCharge},
+		{"BatteryRuntime", a.BatteryRuntime, b.BatteryRuntime},
+		{"InputVoltage", a.InputVoltage, b.InputVoltage},
+		{"OutputVoltage", a.OutputVoltage, b.OutputVoltage},
+		{"Load", a.Load, b.Load},
+	} {
+		if !valuesEqual(field.old, field.new, limit) {
+			changes = append(changes, FieldChange{field.name, field.old, field.new})
+		}
+	}
+	return changes
+}
+
+// valuesEqual compares two variable values, treating numbers within tolerance of each other as equal.
+func valuesEqual(a, b interface{}, tolerance float64) bool {
+	aNumber, aIsNumber := numericValue(a)
+	bNumber, bIsNumber := numericValue(b)
+	if aIsNumber && bIsNumber {
+		difference := aNumber - bNumber
+		if difference < 0 {
+			difference = -difference
+		}
+		return difference <= tolerance
+	}
+	return a == b
+}
+
+// numericValue returns v as a float64 if it is one of the numeric types produced by GetVariables.
+func numericValue(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
@@ -0,0 +1,98 @@
+package nut
+
+import "testing"
+
+func TestDiffUPS(t *testing.T) {
+	before := UPS{
+		Description:    "Rack A",
+		NumberOfLogins: 1,
+		Variables: []Variable{
+			{Name: "ups.status", Value: "OL", Type: "STRING"},
+			{Name: "input.voltage", Value: 230.0, Type: "FLOAT_64"},
+			{Name: "output.voltage", Value: 230.0, Type: "FLOAT_64"},
+			{Name: "battery.charge", Value: int64(100), Type: "INTEGER"},
+		},
+	}
+	after := UPS{
+		Description:    "Rack A",
+		NumberOfLogins: 1,
+		Variables: []Variable{
+			{Name: "ups.status", Value: "OB DISCHRG", Type: "STRING"},
+			{Name: "input.voltage", Value: 230.4, Type: "FLOAT_64"},
+			{Name: "output.voltage", Value: 221.0, Type: "FLOAT_64"},
+			{Name: "battery.charge", Value: int64(100), Type: "INTEGER"},
+		},
+	}
+
+	changes := DiffUPS(before, after, 1)
+	if len(changes) != 2 {
+		t.Fatalf("expected 2 changes, got %+v", changes)
+	}
+	if changes[0] != (FieldChange{"output.voltage", 230.0, 221.0}) {
+		t.Errorf("expected the out-of-tolerance voltage change, got %+v", changes[0])
+	}
+	if changes[1] != (FieldChange{"ups.status", "OL", "OB DISCHRG"}) {
+		t.Errorf("expected the status change, got %+v", changes[1])
+	}
+
+	if changes := DiffUPS(before, after, 0); len(changes) != 3 {
+		t.Errorf("expected the small voltage change to be reported without tolerance, got %+v", changes)
+	}
+}
+
+func TestDiffUPSAddedAndRemoved(t *testing.T) {
+	before := UPS{Variables: []Variable{{Name: "ups.alarm", Value: "Replace battery!"}}}
+	after := UPS{Description: "Rack B", Variables: []Variable{{Name: "ups.beeper.status", Value: false}}}
+
+	changes := DiffUPS(before, after, 0)
+	expected := []FieldChange{
+		{"Description", "", "Rack B"},
+		{"ups.alarm", "Replace battery!", nil},
+		{"ups.beeper.status", nil, false},
+	}
+	if len(changes) != len(expected) {
+		t.Fatalf("expected %+v, got %+v", expected, changes)
+	}
+	for i := range expected {
+		if changes[i] != expected[i] {
+			t.Errorf("change %d: expected %+v, got %+v", i, expected[i], changes[i])
+		}
+	}
+}
+
+func TestDiffSummary(t *testing.T) {
+	before := UPSSummary{Name: "ups", Status: "OL", BatteryCharge: 100, InputVoltage: 230, OutputVoltage: 230}
+	after := UPSSummary{Name: "ups", Status: "OB DISCHRG", BatteryCharge: 100, InputVoltage: 230.4, OutputVoltage: 221}
+
+	changes := DiffSummary(before, after, 1)
+	expected := []FieldChange{
+		{"Status", "OL", "OB DISCHRG"},
+		{"OutputVoltage", 230.0, 221.0},
+	}
+	if len(changes) != len(expected) {
+		t.Fatalf("expected %+v, got %+v", expected, changes)
+	}
+	for i := range expected {
+		if changes[i] != expected[i] {
+			t.Errorf("change %d: expected %+v, got %+v", i, expected[i], changes[i])
+		}
+	}
+
+	if changes := DiffSummary(before, after); len(changes) != 3 {
+		t.Errorf("expected the small voltage change to be reported without tolerance, got %+v", changes)
+	}
+}
+
+func TestGetSummary(t *testing.T) {
+	server := newMockServer(t)
+	server.addUPS("ups", "", map[string]string{"ups.status": "OL CHRG", "battery.charge": "95", "input.voltage": "229.8", "ups.load": "23"})
+
+	summary, err := testUPS(server, "ups").GetSummary()
+	if err != nil {
+		t.Fatalf("GetSummary: %v", err)
+	}
+	expected := UPSSummary{Name: "ups", Status: "OL CHRG", BatteryCharge: 95, InputVoltage: 229.8, Load: 23}
+	if summary != expected {
+		t.Errorf("expected %+v, got %+v", expected, summary)
+	}
+}
@@ -0,0 +1,33 @@
+package nut
+
+import "time"
+
+// SuggestedPollInterval returns the driver's poll interval (driver.parameter.pollinterval), so that clients can avoid polling faster than the driver updates.
+// If the UPS does not report it, (0, false, nil) is returned.
+func (u *UPS) SuggestedPollInterval() (time.Duration, bool, error) {
+	seconds, err := u.getFloatVariable("driver.parameter.pollinterval")
+	if err == ErrVarNotSupported {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return time.Duration(seconds * float64(time.Second)), true, nil
+}
+
+// DriverState returns the driver lifecycle state reported in driver.state, such as "init.start", "updateinfo", "dumping", "reconnect" or "quiet".
+// If the driver does not report its state, ErrVarNotSupported is returned.
+func (u *UPS) DriverState() (string, error) {
+	return u.getVariableValue("driver.state")
+}
+
+// IsDriverHealthy reports whether the driver is in its steady "quiet" state.
+// Any other state is transient (starting up, dumping or reconnecting) and may explain stale data.
+// If the driver does not report its state, ErrVarNotSupported is returned.
+func (u *UPS) IsDriverHealthy() (bool, error) {
+	state, err := u.DriverState()
+	if err != nil {
+		return false, err
+	}
+	return state == "quiet", nil
+}
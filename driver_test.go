@@ -0,0 +1,39 @@
+package nut
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSuggestedPollInterval(t *testing.T) {
+	server := newMockServer(t)
+	server.addUPS("tuned", "", map[string]string{"driver.parameter.pollinterval": "15"})
+	server.addUPS("default", "", map[string]string{"driver.name": "usbhid-ups"})
+
+	interval, ok, err := testUPS(server, "tuned").SuggestedPollInterval()
+	if err != nil || !ok || interval != 15*time.Second {
+		t.Errorf("expected 15s, got %v, %v, %v", interval, ok, err)
+	}
+	interval, ok, err = testUPS(server, "default").SuggestedPollInterval()
+	if err != nil || ok || interval != 0 {
+		t.Errorf("expected (0, false, nil), got %v, %v, %v", interval, ok, err)
+	}
+}
+
+func TestIsDriverHealthy(t *testing.T) {
+	server := newMockServer(t)
+	server.addUPS("quiet", "", map[string]string{"driver.state": "quiet"})
+	server.addUPS("reconnecting", "", map[string]string{"driver.state": "reconnect"})
+	server.addUPS("legacy", "", map[string]string{"driver.name": "usbhid-ups"})
+
+	if healthy, err := testUPS(server, "quiet").IsDriverHealthy(); err != nil || !healthy {
+		t.Errorf("expected a quiet driver to be healthy, got %v, %v", healthy, err)
+	}
+	if healthy, err := testUPS(server, "reconnecting").IsDriverHealthy(); err != nil || healthy {
+		t.Errorf("expected a reconnecting driver to be unhealthy, got %v, %v", healthy, err)
+	}
+	if _, err := testUPS(server, "legacy").IsDriverHealthy(); !errors.Is(err, ErrVarNotSupported) {
+		t.Errorf("expected ErrVarNotSupported, got %v", err)
+	}
+}
@@ -2,57 +2,108 @@ package nut
 
 import "errors"
 
+// ErrNotNUTServer is returned by Connect when the server's reply is clearly not from upsd,
+// e.g. when pointed at an HTTP server or a binary protocol such as SNMP.
+var ErrNotNUTServer = errors.New("The server did not respond with the NUT protocol. Check that the address points at upsd")
+
+// ErrServerBusy is returned by Connect when the server accepts the connection but closes it before replying,
+// which is how upsd refuses connections once MAXCONN is reached. This is a heuristic: a server that crashes
+// or is restarted at that moment looks the same, while a refused dial (nothing listening) is returned unchanged.
+// Callers should back off before reconnecting.
+var ErrServerBusy = errors.New("The server closed the connection without replying. It may have reached its maximum number of connections")
+
+// ErrReadOnlyClient is returned when a command which changes UPS state is attempted on a client with ReadOnly set.
+var ErrReadOnlyClient = errors.New("The client is read-only and refuses to send commands which change UPS state")
+
+// ErrInsecureTransport is returned when a command which changes UPS state is attempted over plaintext on a client with RequireTLSForWrites set.
+var ErrInsecureTransport = errors.New("The connection is not encrypted and the client requires TLS for commands which change UPS state")
+
+// ErrTLSCertificate is returned when a TLS certificate is rejected, either the server's by the client or the client's by the server.
+var ErrTLSCertificate = errors.New("The TLS certificate was rejected. Check the server certificate and, for mutual TLS, the client certificate")
+
+// ErrResponseTooLarge is returned when a single command's response exceeds the client's MaxResponseBytes.
+// The rest of the response is not read, so the connection is out of step with the server and should be closed.
+var ErrResponseTooLarge = errors.New("The server's response exceeded the maximum number of bytes allowed for a single command")
+
+// Errors returned by upsd, as described in the NUT network protocol documentation.
+var (
+	ErrAccessDenied         = errors.New("The client’s host and/or authentication details (username, password) are not sufficient to execute the requested command")
+	ErrUnknownUPS           = errors.New("The UPS specified in the request is not known to upsd. This usually means that it didn’t match anything in ups.conf")
+	ErrVarNotSupported      = errors.New("The specified UPS doesn’t support the variable in the request. This is also sent for unrecognized variables which are in a space which is handled by upsd, such as server.*")
+	ErrCmdNotSupported      = errors.New("The specified UPS doesn’t support the instant command in the request")
+	ErrInvalidArgument      = errors.New("The client sent an argument to a command which is not recognized or is otherwise invalid in this context. This is typically caused by sending a valid command like GET with an invalid subcommand")
+	ErrInstCmdFailed        = errors.New("upsd failed to deliver the instant command request to the driver. No further information is available to the client. This typically indicates a dead or broken driver")
+	ErrSetFailed            = errors.New("upsd failed to deliver the set request to the driver. This is just like INSTCMD-FAILED above")
+	ErrReadOnly             = errors.New("The requested variable in a SET command is not writable")
+	ErrTooLong              = errors.New("The requested value in a SET command is too long")
+	ErrFeatureNotSupported  = errors.New("This instance of upsd does not support the requested feature. This is only used for TLS/SSL mode (STARTTLS) at the moment")
+	ErrFeatureNotConfigured = errors.New("This instance of upsd hasn’t been configured properly to allow the requested feature to operate. This is also limited to STARTTLS for now")
+	ErrAlreadySSLMode       = errors.New("TLS/SSL mode is already enabled on this connection, so upsd can’t start it again")
+	ErrDriverNotConnected   = errors.New("upsd can’t perform the requested command, since the driver for that UPS is not connected. This usually means that the driver is not running, or if it is, the ups.conf is misconfigured")
+	ErrDataStale            = errors.New("upsd is connected to the driver for the UPS, but that driver isn’t providing regular updates or has specifically marked the data as stale. upsd refuses to provide variables on stale units to avoid false readings. This generally means that the driver is running, but it has lost communications with the hardware. Check the physical connection to the equipment")
+	ErrAlreadyLoggedIn      = errors.New("The client already sent LOGIN for a UPS and can’t do it again. There is presently a limit of one LOGIN record per connection")
+	ErrInvalidPassword      = errors.New("The client sent an invalid PASSWORD - perhaps an empty one")
+	ErrAlreadySetPassword   = errors.New("The client already set a PASSWORD and can’t set another. This also should never happen with normal NUT clients")
+	ErrInvalidUsername      = errors.New("The client sent an invalid USERNAME")
+	ErrAlreadySetUsername   = errors.New("The client has already set a USERNAME, and can’t set another. This should never happen with normal NUT clients")
+	ErrUsernameRequired     = errors.New("The requested command requires a username for authentication, but the client hasn’t set one")
+	ErrPasswordRequired     = errors.New("The requested command requires a passname for authentication, but the client hasn’t set one")
+	ErrUnknownCommand       = errors.New("upsd doesn’t recognize the requested command")
+	ErrInvalidValue         = errors.New("The value specified in the request is not valid. This usually applies to a SET of an ENUM type which is using a value which is not in the list of allowed values")
+	ErrUnknownErrorCode     = errors.New("Unknown error code")
+)
+
 // errorForMessage returns an error for the specified NUT error code.
 func errorForMessage(message string) (err error) {
 	switch message {
 	case "ACCESS-DENIED":
-		err = errors.New("The client’s host and/or authentication details (username, password) are not sufficient to execute the requested command")
+		err = ErrAccessDenied
 	case "UNKNOWN-UPS":
-		err = errors.New("The UPS specified in the request is not known to upsd. This usually means that it didn’t match anything in ups.conf")
+		err = ErrUnknownUPS
 	case "VAR-NOT-SUPPORTED":
-		err = errors.New("The specified UPS doesn’t support the variable in the request. This is also sent for unrecognized variables which are in a space which is handled by upsd, such as server.*")
+		err = ErrVarNotSupported
 	case "CMD-NOT-SUPPORTED":
-		err = errors.New("The specified UPS doesn’t support the instant command in the request")
+		err = ErrCmdNotSupported
 	case "INVALID-ARGUMENT":
-		err = errors.New("The client sent an argument to a command which is not recognized or is otherwise invalid in this context. This is typically caused by sending a valid command like GET with an invalid subcommand")
+		err = ErrInvalidArgument
 	case "INSTCMD-FAILED":
-		err = errors.New("upsd failed to deliver the instant command request to the driver. No further information is available to the client. This typically indicates a dead or broken driver")
+		err = ErrInstCmdFailed
 	case "SET-FAILED":
-		err = errors.New("upsd failed to deliver the set request to the driver. This is just like INSTCMD-FAILED above")
+		err = ErrSetFailed
 	case "READONLY":
-		err = errors.New("The requested variable in a SET command is not writable")
+		err = ErrReadOnly
 	case "TOO-LONG":
-		err = errors.New("The requested value in a SET command is too long")
+		err = ErrTooLong
 	case "FEATURE-NOT-SUPPORTED":
-		err = errors.New("This instance of upsd does not support the requested feature. This is only used for TLS/SSL mode (STARTTLS) at the moment")
+		err = ErrFeatureNotSupported
 	case "FEATURE-NOT-CONFIGURED":
-		err = errors.New("This instance of upsd hasn’t been configured properly to allow the requested feature to operate. This is also limited to STARTTLS for now")
+		err = ErrFeatureNotConfigured
 	case "ALREADY-SSL-MODE":
-		err = errors.New("TLS/SSL mode is already enabled on this connection, so upsd can’t start it again")
+		err = ErrAlreadySSLMode
 	case "DRIVER-NOT-CONNECTED":
-		err = errors.New("upsd can’t perform the requested command, since the driver for that UPS is not connected. This usually means that the driver is not running, or if it is, the ups.conf is misconfigured")
+		err = ErrDriverNotConnected
 	case "DATA-STALE":
-		err = errors.New("upsd is connected to the driver for the UPS, but that driver isn’t providing regular updates or has specifically marked the data as stale. upsd refuses to provide variables on stale units to avoid false readings. This generally means that the driver is running, but it has lost communications with the hardware. Check the physical connection to the equipment")
+		err = ErrDataStale
 	case "ALREADY-LOGGED-IN":
-		err = errors.New("The client already sent LOGIN for a UPS and can’t do it again. There is presently a limit of one LOGIN record per connection")
+		err = ErrAlreadyLoggedIn
 	case "INVALID-PASSWORD":
-		err = errors.New("The client sent an invalid PASSWORD - perhaps an empty one")
+		err = ErrInvalidPassword
 	case "ALREADY-SET-PASSWORD":
-		err = errors.New("The client already set a PASSWORD and can’t set another. This also should never happen with normal NUT clients")
+		err = ErrAlreadySetPassword
 	case "INVALID-USERNAME":
-		err = errors.New("The client sent an invalid USERNAME")
+		err = ErrInvalidUsername
 	case "ALREADY-SET-USERNAME":
-		err = errors.New("The client has already set a USERNAME, and can’t set another. This should never happen with normal NUT clients")
+		err = ErrAlreadySetUsername
 	case "USERNAME-REQUIRED":
-		err = errors.New("The requested command requires a username for authentication, but the client hasn’t set one")
+		err = ErrUsernameRequired
 	case "PASSWORD-REQUIRED":
-		err = errors.New("The requested command requires a passname for authentication, but the client hasn’t set one")
+		err = ErrPasswordRequired
 	case "UNKNOWN-COMMAND":
-		err = errors.New("upsd doesn’t recognize the requested command")
+		err = ErrUnknownCommand
 	case "INVALID-VALUE":
-		err = errors.New("The value specified in the request is not valid. This usually applies to a SET of an ENUM type which is using a value which is not in the list of allowed values")
+		err = ErrInvalidValue
 	default:
-		err = errors.New("Unknown error code")
+		err = ErrUnknownErrorCode
 	}
 
 	return err
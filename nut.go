@@ -5,9 +5,22 @@ package nut
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
 	"fmt"
+	"io"
 	"net"
+	"path"
+	"regexp"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 // Client contains information about the NUT server as well as the connection.
@@ -15,7 +28,50 @@ type Client struct {
 	Version         string
 	ProtocolVersion string
 	Hostname        net.Addr
-	conn            *net.TCPConn
+	// NormalizeVariableNames lowercases variable names returned by GetVariables and related helpers such as FlatSnapshot.
+	// It is off by default so that names are exactly as sent by upsd. Note that names which differ only by case will collide.
+	NormalizeVariableNames bool
+	// RewriteCommand, if set, is applied to every command just before it is sent, and may modify it.
+	// This is useful for fault injection or adapting to nonstandard servers. nil sends commands unchanged.
+	RewriteCommand func(cmd string) string
+	// OnUnsolicited, if set, receives lines which do not fit the framing of the response being read, such as notices pushed by a proxy.
+	// Such lines are always dropped from the response; without a callback they are discarded silently.
+	OnUnsolicited func(line string)
+	// ReadOnly makes the client refuse commands which change UPS state (SET, INSTCMD and FSD) with ErrReadOnlyClient,
+	// without sending them. This is a client-side safety rail independent of upsd's access control.
+	ReadOnly bool
+	// RequireTLSForWrites makes the client refuse commands which change UPS state with ErrInsecureTransport,
+	// without sending them, unless the session has been upgraded with StartTLS. See Encrypted.
+	RequireTLSForWrites bool
+	// MinTLSVersion is the minimum TLS version accepted by StartTLS. Zero means tls.VersionTLS12.
+	MinTLSVersion uint16
+	// TLSCipherSuites, if set, restricts the cipher suites offered by StartTLS. It does not apply to TLS 1.3.
+	TLSCipherSuites []uint16
+	// MaxResponseBytes limits the total size of the response to a single command, including line endings.
+	// A response which exceeds it fails with ErrResponseTooLarge. Zero means no limit.
+	MaxResponseBytes int
+
+	conn net.Conn
+	// reader buffers conn for as long as the connection lives, so that replies read ahead, such as those to pipelined commands, are kept between reads.
+	reader *bufio.Reader
+	// host is the hostname passed to Connect, used as the default TLS server name.
+	host string
+	// username is the user upsd accepted with USERNAME. upsd does not allow it to change for the rest of the session.
+	username string
+	// authenticated reports whether upsd also accepted the PASSWORD for username.
+	authenticated bool
+	// passwordHash is the SHA-256 of the password that authenticated the session, kept so the plain password is not held in memory.
+	passwordHash [sha256.Size]byte
+	// now is the time source used for time-based logic; nil means time.Now.
+	now func() time.Time
+}
+
+// clock returns the current time according to the client's time source.
+func (c *Client) clock() time.Time {
+	if c.now == nil {
+		return time.Now()
+	}
+	return c.now()
 }
 
 // Connect accepts a hostname/IP string and creates a connection to NUT, returning a Client.
@@ -28,15 +84,78 @@ func Connect(hostname string) (Client, error) {
 	if err != nil {
 		return Client{}, err
 	}
+	client, err := newClient(conn)
+	client.host = hostname
+	return client, err
+}
+
+// handshakeTimeout bounds the initial VER/NETVER exchange, so that a server which never sends a complete line cannot hang Connect.
+var handshakeTimeout = 5 * time.Second
+
+// newClient wraps an established connection and performs the initial VER/NETVER exchange.
+// If the first bytes of the reply to VER are clearly not from upsd, the connection is closed and ErrNotNUTServer is returned
+// without waiting for a complete line, which binary protocols may never send.
+func newClient(conn net.Conn) (Client, error) {
 	client := Client{
 		Hostname: conn.RemoteAddr(),
 		conn:     conn,
 	}
-	client.GetVersion()
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	_, err := fmt.Fprint(conn, "VER\n")
+	if err == nil {
+		_, err = client.bufferedReader().Peek(1)
+	}
+	if err != nil {
+		conn.Close()
+		if isDroppedConnection(err) {
+			return Client{}, ErrServerBusy
+		}
+		return Client{}, fmt.Errorf("no reply to VER: %w", err)
+	}
+	// Only the bytes which have already arrived are inspected, up to the end of the first line.
+	firstBytes, _ := client.reader.Peek(client.reader.Buffered())
+	if end := bytes.IndexByte(firstBytes, '\n'); end >= 0 {
+		firstBytes = firstBytes[:end]
+	}
+	if !looksLikeNUT(string(firstBytes)) {
+		conn.Close()
+		return Client{}, ErrNotNUTServer
+	}
+	resp, err := client.readResponse(context.Background(), "", false, nil)
+	if err != nil {
+		conn.Close()
+		return Client{}, fmt.Errorf("no complete reply to VER: %w", err)
+	}
+	if !strings.HasPrefix(resp[0], "ERR ") {
+		client.Version = resp[0]
+	}
 	client.GetNetworkProtocolVersion()
+	conn.SetDeadline(time.Time{})
 	return client, nil
 }
 
+// isDroppedConnection reports whether err means the server closed the connection without replying.
+// upsd does this when it has reached MAXCONN: it accepts the connection and immediately closes it.
+func isDroppedConnection(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE)
+}
+
+// looksLikeNUT reports whether line could plausibly be a reply from upsd.
+// It only rejects replies which are obviously from another protocol, such as HTTP, SSH or binary data.
+func looksLikeNUT(line string) bool {
+	for _, prefix := range []string{"HTTP/", "SSH-", "<"} {
+		if strings.HasPrefix(line, prefix) {
+			return false
+		}
+	}
+	for _, r := range line {
+		if r == utf8.RuneError || (unicode.IsControl(r) && r != '\t' && r != '\r') {
+			return false
+		}
+	}
+	return true
+}
+
 // Disconnect gracefully disconnects from NUT by sending the LOGOUT command.
 func (c *Client) Disconnect() (bool, error) {
 	logoutResp, err := c.SendCommand("LOGOUT")
@@ -51,19 +170,70 @@ func (c *Client) Disconnect() (bool, error) {
 
 // ReadResponse is a convenience function for reading newline delimited responses.
 func (c *Client) ReadResponse(endLine string, multiLineResponse bool) (resp []string, err error) {
-	connbuff := bufio.NewReader(c.conn)
+	return c.readResponse(context.Background(), endLine, multiLineResponse, nil)
+}
+
+// readResponse reads a response like ReadResponse, but stops as soon as ctx is done.
+// ctx is checked between lines, and a blocked read is interrupted by moving the connection's read deadline.
+// If expectedPrefixes is not nil, lines starting with none of them are passed to OnUnsolicited and left out of the response.
+func (c *Client) readResponse(ctx context.Context, endLine string, multiLineResponse bool, expectedPrefixes []string) (resp []string, err error) {
+	if ctx.Done() != nil {
+		stop := c.interruptReadsOnDone(ctx)
+		defer stop()
+	}
+	connbuff := c.bufferedReader()
 	response := []string{}
+	responseBytes := 0
+	var listErr error
 
 	for {
-		line, err := connbuff.ReadString('\n')
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		remaining := -1
+		if c.MaxResponseBytes > 0 {
+			remaining = c.MaxResponseBytes - responseBytes
+		}
+		line, err := readLine(connbuff, remaining)
+		responseBytes += len(line)
 		if err != nil {
-			return nil, fmt.Errorf("error reading response: %v", err)
+			if err == ErrResponseTooLarge {
+				return nil, err
+			}
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, ctxErr
+			}
+			if isCertificateError(err) {
+				return nil, fmt.Errorf("%w: %v", ErrTLSCertificate, err)
+			}
+			return nil, fmt.Errorf("error reading response: %w", err)
 		}
 		if len(line) > 0 {
 			cleanLine := strings.TrimSuffix(line, "\n")
+			if expectedPrefixes != nil && !hasAnyPrefix(cleanLine, expectedPrefixes) {
+				if c.OnUnsolicited != nil {
+					c.OnUnsolicited(cleanLine)
+				}
+				continue
+			}
 			lines := strings.Split(cleanLine, "\n")
+			// An ERR inside a BEGIN/END block aborts the list rather than being returned as data.
+			// The rest of the block is still read up to endLine, so that it is not taken as the reply to the next command.
+			if len(response) > 0 && strings.HasPrefix(cleanLine, "ERR ") {
+				if listErr == nil {
+					listErr = errorForMessage(strings.Split(cleanLine, " ")[1])
+				}
+				continue
+			}
+			if listErr != nil {
+				if line == endLine {
+					return nil, listErr
+				}
+				continue
+			}
 			response = append(response, lines...)
-			if line == endLine || multiLineResponse == false {
+			// upsd replies to a failed LIST with a single ERR line instead of a BEGIN/END block.
+			if line == endLine || multiLineResponse == false || (len(response) == 1 && strings.HasPrefix(line, "ERR ")) {
 				break
 			}
 		}
@@ -72,8 +242,68 @@ func (c *Client) ReadResponse(endLine string, multiLineResponse bool) (resp []st
 	return response, err
 }
 
+// bufferedReader returns the reader for the connection, creating it on first use.
+func (c *Client) bufferedReader() *bufio.Reader {
+	if c.reader == nil {
+		c.reader = bufio.NewReader(c.conn)
+	}
+	return c.reader
+}
+
+// readLine reads up to and including the next '\n'. If max is not negative and the line is longer than max bytes,
+// ErrResponseTooLarge is returned as soon as that is known, without buffering the rest of the line.
+func readLine(reader *bufio.Reader, max int) (string, error) {
+	var line []byte
+	for {
+		fragment, err := reader.ReadSlice('\n')
+		line = append(line, fragment...)
+		if max >= 0 && len(line) > max {
+			return "", ErrResponseTooLarge
+		}
+		if err != bufio.ErrBufferFull {
+			return string(line), err
+		}
+	}
+}
+
+// interruptReadsOnDone applies ctx's deadline to the connection and interrupts any blocked read when ctx is done.
+// The returned function must be called once reading is finished; it restores the connection to having no read deadline.
+func (c *Client) interruptReadsOnDone(ctx context.Context) func() {
+	if deadline, ok := ctx.Deadline(); ok {
+		c.conn.SetReadDeadline(deadline)
+	}
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			c.conn.SetReadDeadline(time.Now())
+		case <-stop:
+		}
+	}()
+	return func() {
+		close(stop)
+		<-stopped
+		c.conn.SetReadDeadline(time.Time{})
+	}
+}
+
 // SendCommand sends the string cmd to the device, and returns the response.
 func (c *Client) SendCommand(cmd string) (resp []string, err error) {
+	return c.SendCommandContext(context.Background(), cmd)
+}
+
+// SendCommandContext is like SendCommand, but returns ctx's error as soon as ctx is done, even in the middle of a long LIST response.
+// A cancelled command leaves the rest of its response unread, so the connection should be closed rather than reused.
+func (c *Client) SendCommandContext(ctx context.Context, cmd string) (resp []string, err error) {
+	cmd, err = c.prepareCommand(cmd)
+	if err != nil {
+		return []string{}, err
+	}
+	if err := ctx.Err(); err != nil {
+		return []string{}, err
+	}
 	cmd = fmt.Sprintf("%v\n", cmd)
 	endLine := fmt.Sprintf("END %s", cmd)
 	if strings.HasPrefix(cmd, "USERNAME ") || strings.HasPrefix(cmd, "PASSWORD ") || strings.HasPrefix(cmd, "SET ") || strings.HasPrefix(cmd, "HELP ") || strings.HasPrefix(cmd, "VER ") || strings.HasPrefix(cmd, "NETVER ") {
@@ -84,7 +314,7 @@ func (c *Client) SendCommand(cmd string) (resp []string, err error) {
 		return []string{}, err
 	}
 
-	resp, err = c.ReadResponse(endLine, strings.HasPrefix(cmd, "LIST "))
+	resp, err = c.readResponse(ctx, endLine, strings.HasPrefix(cmd, "LIST "), responsePrefixes(cmd))
 	if err != nil {
 		return []string{}, err
 	}
@@ -96,40 +326,327 @@ func (c *Client) SendCommand(cmd string) (resp []string, err error) {
 	return resp, nil
 }
 
+// prepareCommand applies RewriteCommand to cmd and then the ReadOnly and RequireTLSForWrites checks, returning the command to send.
+func (c *Client) prepareCommand(cmd string) (string, error) {
+	if c.RewriteCommand != nil {
+		cmd = c.RewriteCommand(cmd)
+	}
+	if c.ReadOnly && isMutatingCommand(cmd) {
+		return "", ErrReadOnlyClient
+	}
+	if c.RequireTLSForWrites && !c.Encrypted() && isMutatingCommand(cmd) {
+		return "", ErrInsecureTransport
+	}
+	return cmd, nil
+}
+
+// sendPipelined sends cmds, which must each have a single-line reply such as GET, in one write and then reads the replies in order,
+// saving a round trip per command. The reply to each command is returned at the same index, or the upsd error it produced in errs.
+// The error return is only set if the commands cannot be sent or a reply cannot be read, in which case the connection should be closed.
+func (c *Client) sendPipelined(cmds []string) (replies []string, errs []error, err error) {
+	var batch strings.Builder
+	for _, cmd := range cmds {
+		prepared, err := c.prepareCommand(cmd)
+		if err != nil {
+			return nil, nil, err
+		}
+		batch.WriteString(prepared + "\n")
+	}
+	if _, err := io.WriteString(c.conn, batch.String()); err != nil {
+		return nil, nil, err
+	}
+	replies = make([]string, len(cmds))
+	errs = make([]error, len(cmds))
+	for i, cmd := range cmds {
+		resp, err := c.readResponse(context.Background(), "", false, responsePrefixes(cmd))
+		if err != nil {
+			return nil, nil, err
+		}
+		if strings.HasPrefix(resp[0], "ERR ") {
+			errs[i] = errorForMessage(strings.Split(resp[0], " ")[1])
+			continue
+		}
+		replies[i] = resp[0]
+	}
+	return replies, errs, nil
+}
+
+// responsePrefixes returns the prefixes that every line of the response to cmd starts with, or nil if the framing of the response is free-form
+// (VER, HELP, GET TRACKING, ...) or not known. Lines are only filtered when the framing is certain, since dropping the real reply would leave the read waiting forever.
+func responsePrefixes(cmd string) []string {
+	fields := strings.Fields(cmd)
+	if len(fields) == 0 {
+		return nil
+	}
+	switch fields[0] {
+	case "GET":
+		// GET TRACKING replies with a bare status such as "SUCCESS", so it is not listed here.
+		if len(fields) > 1 && hasFlag([]string{"VAR", "TYPE", "DESC", "CMDDESC", "NUMLOGINS", "UPSDESC"}, fields[1]) {
+			return []string{fields[1] + " ", "ERR "}
+		}
+	case "LIST":
+		if len(fields) > 1 && hasFlag([]string{"UPS", "VAR", "RW", "CMD", "ENUM", "RANGE", "CLIENT"}, fields[1]) {
+			return []string{"BEGIN LIST ", "END LIST ", fields[1] + " ", "ERR "}
+		}
+	case "SET", "INSTCMD", "USERNAME", "PASSWORD", "LOGIN", "MASTER", "PRIMARY", "FSD", "STARTTLS":
+		return []string{"OK", "ERR "}
+	}
+	return nil
+}
+
+// hasAnyPrefix reports whether s starts with any of prefixes.
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// BuildCommand joins parts into a NUT command suitable for SendCommand, quoting and escaping any part which contains spaces,
+// quotes or backslashes, or is empty. Parts containing line breaks are rejected, since they would end the command early.
+//
+// For example BuildCommand("SET", "VAR", "myups", "ups.id", `Rack "A"`) returns `SET VAR myups ups.id "Rack \"A\""`.
+func BuildCommand(parts ...string) (string, error) {
+	if len(parts) == 0 {
+		return "", errors.New("no command given")
+	}
+	quoted := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if strings.ContainsAny(part, "\r\n") {
+			return "", fmt.Errorf("command part %q contains a line break", part)
+		}
+		if part == "" || strings.ContainsAny(part, " \t\"\\") {
+			part = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(part) + `"`
+		}
+		quoted = append(quoted, part)
+	}
+	return strings.Join(quoted, " "), nil
+}
+
+// isMutatingCommand reports whether cmd changes the state of a UPS.
+// The command name is matched the way upsd parses it: after any leading whitespace and regardless of case.
+func isMutatingCommand(cmd string) bool {
+	fields := strings.Fields(cmd)
+	if len(fields) == 0 {
+		return false
+	}
+	for _, name := range []string{"SET", "INSTCMD", "FSD"} {
+		if strings.EqualFold(fields[0], name) {
+			return true
+		}
+	}
+	return false
+}
+
 // Authenticate accepts a username and passwords and uses them to authenticate the existing NUT session.
+//
+// upsd only accepts one USERNAME and PASSWORD per connection. Calling Authenticate again with the credentials
+// that already authenticated the session is treated as success and returns (true, nil) without resending anything.
+// Calling it with a different username returns ErrAlreadySetUsername, and with the same username but a different password
+// ErrAlreadySetPassword; either way the session keeps its original credentials.
+// If upsd accepted the username but rejected the password, a retry with the same username only resends PASSWORD.
+// If the session was authenticated by other means (e.g. a raw SendCommand), upsd's ErrAlreadySetUsername or ErrAlreadyLoggedIn is returned as is.
 func (c *Client) Authenticate(username, password string) (bool, error) {
-	usernameResp, err := c.SendCommand(fmt.Sprintf("USERNAME %s", username))
-	if err != nil {
-		return false, err
+	if c.username != "" && c.username != username {
+		return false, ErrAlreadySetUsername
+	}
+	passwordHash := sha256.Sum256([]byte(password))
+	if c.authenticated {
+		if subtle.ConstantTimeCompare(passwordHash[:], c.passwordHash[:]) != 1 {
+			return false, ErrAlreadySetPassword
+		}
+		return true, nil
+	}
+	if c.username == "" {
+		usernameResp, err := c.SendCommand(fmt.Sprintf("USERNAME %s", username))
+		if err != nil {
+			return false, err
+		}
+		if usernameResp[0] != "OK" {
+			return false, nil
+		}
+		c.username = username
 	}
 	passwordResp, err := c.SendCommand(fmt.Sprintf("PASSWORD %s", password))
 	if err != nil {
 		return false, err
 	}
-	if usernameResp[0] == "OK" && passwordResp[0] == "OK" {
-		return true, nil
+	if passwordResp[0] != "OK" {
+		return false, nil
 	}
-	return false, nil
+	c.authenticated = true
+	c.passwordHash = passwordHash
+	return true, nil
 }
 
 // GetUPSList returns a list of all UPSes provided by this NUT instance.
 func (c *Client) GetUPSList() ([]UPS, error) {
+	return c.getMatchingUPSList(func(string) bool { return true })
+}
+
+// ListUPSMatching returns the UPSes whose names match the glob pattern, e.g. "rack-a-*", using the syntax of path.Match.
+// Filtering is done client-side; only matching UPSes are queried.
+func (c *Client) ListUPSMatching(pattern string) ([]UPS, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return []UPS{}, err
+	}
+	return c.getMatchingUPSList(func(name string) bool {
+		matched, _ := path.Match(pattern, name)
+		return matched
+	})
+}
+
+// ListUPSMatchingRegexp returns the UPSes whose names match the regular expression expr.
+// Filtering is done client-side; only matching UPSes are queried.
+func (c *Client) ListUPSMatchingRegexp(expr string) ([]UPS, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return []UPS{}, err
+	}
+	return c.getMatchingUPSList(re.MatchString)
+}
+
+// getMatchingUPSList returns the UPSes whose names satisfy match, in the order reported by LIST UPS.
+// Descriptions are taken from LIST UPS rather than queried with GET UPSDESC.
+func (c *Client) getMatchingUPSList(match func(name string) bool) ([]UPS, error) {
 	upsList := []UPS{}
-	resp, err := c.SendCommand("LIST UPS")
+	listed, err := c.listUPS()
 	if err != nil {
 		return upsList, err
 	}
+	for _, newUPS := range listed {
+		if !match(newUPS.Name) {
+			continue
+		}
+		if err := newUPS.load(); err != nil {
+			return upsList, err
+		}
+		upsList = append(upsList, newUPS)
+	}
+	return upsList, err
+}
+
+// upsNames returns the names of all UPSes provided by this NUT instance without querying each of them.
+func (c *Client) upsNames() ([]string, error) {
+	names := []string{}
+	listed, err := c.listUPS()
+	if err != nil {
+		return names, err
+	}
+	for _, ups := range listed {
+		names = append(names, ups.Name)
+	}
+	return names, nil
+}
+
+// listUPS returns the UPSes in LIST UPS with only their name and description filled in.
+func (c *Client) listUPS() ([]UPS, error) {
+	listed := []UPS{}
+	resp, err := c.SendCommand("LIST UPS")
+	if err != nil {
+		return listed, err
+	}
 	for _, line := range resp {
 		if strings.HasPrefix(line, "UPS ") {
-			splitLine := strings.Split(strings.TrimPrefix(line, "UPS "), `"`)
-			newUPS, err := NewUPS(strings.TrimSuffix(splitLine[0], " "), c)
-			if err != nil {
-				return upsList, err
-			}
-			upsList = append(upsList, newUPS)
+			name, description := parseUPSLine(line)
+			listed = append(listed, UPS{Name: name, Description: description, nutClient: c})
 		}
 	}
-	return upsList, err
+	return listed, nil
+}
+
+// parseUPSLine parses a `UPS <name> "<description>"` line from LIST UPS.
+// Some servers omit the description entirely, in which case it is returned as "".
+func parseUPSLine(line string) (name, description string) {
+	splitLine := strings.SplitN(strings.TrimSpace(strings.TrimPrefix(line, "UPS ")), " ", 2)
+	name = splitLine[0]
+	if len(splitLine) == 2 {
+		description = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(splitLine[1]), `"`), `"`)
+	}
+	return name, description
+}
+
+// FlatSnapshot polls every UPS and returns all of their variables in a single map.
+// Each key is the variable name prefixed with the name of its UPS, e.g. "myups.battery.charge".
+func (c *Client) FlatSnapshot() (map[string]string, error) {
+	snapshot := map[string]string{}
+	names, err := c.upsNames()
+	if err != nil {
+		return snapshot, err
+	}
+	for _, name := range names {
+		ups := UPS{Name: name, nutClient: c}
+		_, values, err := ups.getRawVariables()
+		if err != nil {
+			return snapshot, err
+		}
+		for variableName, value := range values {
+			snapshot[fmt.Sprintf("%s.%s", name, variableName)] = value
+		}
+	}
+	return snapshot, nil
+}
+
+// variableName returns name as it should be presented to callers, honouring NormalizeVariableNames.
+func (c *Client) variableName(name string) string {
+	if c.NormalizeVariableNames {
+		return strings.ToLower(name)
+	}
+	return name
+}
+
+// OwnedVariable is a variable together with the name of the UPS that provides it.
+type OwnedVariable struct {
+	UPS   string
+	Name  string
+	Value string
+}
+
+// AllVariables returns every variable of every UPS as a flat list, in the order reported by upsd.
+// A UPS whose variables cannot be listed is skipped and its error recorded in the map; the error return is only set if LIST UPS fails.
+func (c *Client) AllVariables() ([]OwnedVariable, map[string]error, error) {
+	variables := []OwnedVariable{}
+	upsErrors := map[string]error{}
+	names, err := c.upsNames()
+	if err != nil {
+		return variables, upsErrors, err
+	}
+	for _, name := range names {
+		ups := UPS{Name: name, nutClient: c}
+		variableNames, values, err := ups.getRawVariables()
+		if err != nil {
+			upsErrors[name] = err
+			continue
+		}
+		for _, variableName := range variableNames {
+			variables = append(variables, OwnedVariable{UPS: name, Name: variableName, Value: values[variableName]})
+		}
+	}
+	return variables, upsErrors, nil
+}
+
+// AllCommands returns the instant commands, with descriptions, of every UPS keyed by UPS name.
+// Each UPS takes two round trips: LIST CMD, then its GET CMDDESC queries pipelined in a single batch.
+// A UPS whose commands cannot be listed is skipped and its error recorded in the second map; the error return is only set if LIST UPS fails.
+func (c *Client) AllCommands() (map[string][]Command, map[string]error, error) {
+	commands := map[string][]Command{}
+	upsErrors := map[string]error{}
+	names, err := c.upsNames()
+	if err != nil {
+		return commands, upsErrors, err
+	}
+	for _, name := range names {
+		ups := UPS{Name: name, nutClient: c}
+		upsCommands, err := ups.GetCommands()
+		if err != nil {
+			upsErrors[name] = err
+			continue
+		}
+		commands[name] = upsCommands
+	}
+	return commands, upsErrors, nil
 }
 
 // Help returns a list of the commands supported by NUT.
@@ -141,13 +658,101 @@ func (c *Client) Help() (string, error) {
 // GetVersion returns the the version of the server currently in use.
 func (c *Client) GetVersion() (string, error) {
 	versionResponse, err := c.SendCommand("VER")
+	if err != nil {
+		return "", err
+	}
 	c.Version = versionResponse[0]
 	return versionResponse[0], err
 }
 
+// latencyTimeout bounds how long Latency waits for the server to reply.
+const latencyTimeout = 5 * time.Second
+
+// Latency measures the protocol-level round-trip time to the server by timing a VER command.
+// Unlike GetVersion it does not update the client's Version.
+func (c *Client) Latency() (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), latencyTimeout)
+	defer cancel()
+	start := c.clock()
+	if _, err := c.SendCommandContext(ctx, "VER"); err != nil {
+		return 0, err
+	}
+	return c.clock().Sub(start), nil
+}
+
 // GetNetworkProtocolVersion returns the version of the network protocol currently in use.
 func (c *Client) GetNetworkProtocolVersion() (string, error) {
 	versionResponse, err := c.SendCommand("NETVER")
+	if err != nil {
+		return "", err
+	}
 	c.ProtocolVersion = versionResponse[0]
 	return versionResponse[0], err
 }
+
+// ServerVersion holds the versions reported by a single NUT server, or the error encountered while connecting to or querying it.
+type ServerVersion struct {
+	// Server is the hostname passed to ConnectServerVersions, or the client's address for ServerVersions ("" if it has none).
+	Server          string
+	Version         string
+	ProtocolVersion string
+	Err             error
+}
+
+// ServerVersions queries VER and NETVER on every client concurrently and returns one result per client, in the same order as clients.
+// Clients which cannot be queried, for example because the connection has been closed, are included with Err set.
+func ServerVersions(clients []*Client) []ServerVersion {
+	versions := make([]ServerVersion, len(clients))
+	var wg sync.WaitGroup
+	for i, client := range clients {
+		wg.Add(1)
+		go func(i int, c *Client) {
+			defer wg.Done()
+			if c.Hostname != nil {
+				versions[i].Server = c.Hostname.String()
+			}
+			versions[i].Version, versions[i].ProtocolVersion, versions[i].Err = c.queryVersions()
+		}(i, client)
+	}
+	wg.Wait()
+	return versions
+}
+
+// ConnectServerVersions connects to every hostname concurrently, as Connect does, queries VER and NETVER, and disconnects.
+// It returns one result per hostname, in the same order as hostnames. Servers which are unreachable or fail the handshake are included with Err set.
+func ConnectServerVersions(hostnames []string) []ServerVersion {
+	return connectServerVersions(hostnames, Connect)
+}
+
+// connectServerVersions implements ConnectServerVersions using connect to establish each connection.
+func connectServerVersions(hostnames []string, connect func(hostname string) (Client, error)) []ServerVersion {
+	versions := make([]ServerVersion, len(hostnames))
+	var wg sync.WaitGroup
+	for i, hostname := range hostnames {
+		wg.Add(1)
+		go func(i int, hostname string) {
+			defer wg.Done()
+			versions[i].Server = hostname
+			client, err := connect(hostname)
+			if err != nil {
+				versions[i].Err = err
+				return
+			}
+			defer client.conn.Close()
+			versions[i].Version, versions[i].ProtocolVersion, versions[i].Err = client.queryVersions()
+			client.Disconnect()
+		}(i, hostname)
+	}
+	wg.Wait()
+	return versions
+}
+
+// queryVersions returns the server's VER and NETVER replies.
+func (c *Client) queryVersions() (version, protocolVersion string, err error) {
+	version, err = c.GetVersion()
+	if err != nil {
+		return "", "", err
+	}
+	protocolVersion, err = c.GetNetworkProtocolVersion()
+	return version, protocolVersion, err
+}
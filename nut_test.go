@@ -0,0 +1,1183 @@
+package nut
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mockUPS is the state a mockServer reports for a single UPS.
+type mockUPS struct {
+	description string
+	variables   map[string]string
+	types       map[string]string
+	enums       map[string][]string
+	commands    []string
+	clients     []string
+	numLogins   int
+}
+
+// mockServer is a minimal in-process upsd used to exercise the client over a real TCP connection.
+type mockServer struct {
+	t        *testing.T
+	listener net.Listener
+
+	mu       sync.Mutex
+	upsNames []string
+	ups      map[string]*mockUPS
+	received []string
+	// pipelined counts commands which had already arrived before the reply to the previous command was sent.
+	pipelined int
+	// tlsConfig, if set, enables STARTTLS.
+	tlsConfig *tls.Config
+	// lineDelay, if set, is slept between response lines to simulate a slow server.
+	lineDelay time.Duration
+	// hook, if set, is consulted before the built-in handlers. Returning handled=false falls through.
+	hook func(cmd string) (lines []string, handled bool)
+}
+
+func newMockServer(t *testing.T) *mockServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := &mockServer{t: t, listener: listener, ups: map[string]*mockUPS{}}
+	go s.serve()
+	t.Cleanup(func() { listener.Close() })
+	return s
+}
+
+// addUPS registers a UPS with the given variables.
+func (s *mockServer) addUPS(name, description string, variables map[string]string) *mockUPS {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if variables == nil {
+		variables = map[string]string{}
+	}
+	ups := &mockUPS{description: description, variables: variables, types: map[string]string{}, enums: map[string][]string{}}
+	s.upsNames = append(s.upsNames, name)
+	s.ups[name] = ups
+	return ups
+}
+
+// removeUPS unregisters a UPS while the server is running.
+func (s *mockServer) removeUPS(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.ups, name)
+	for i, n := range s.upsNames {
+		if n == name {
+			s.upsNames = append(s.upsNames[:i], s.upsNames[i+1:]...)
+			break
+		}
+	}
+}
+
+// setVariable changes a variable while the server is running.
+func (s *mockServer) setVariable(upsName, name, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ups[upsName].variables[name] = value
+}
+
+// commands returns every command line the server has received so far.
+func (s *mockServer) commands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.received...)
+}
+
+// client dials the server and returns a Client without the VER/NETVER handshake done by Connect.
+func (s *mockServer) client() *Client {
+	conn, err := net.DialTCP("tcp", nil, s.listener.Addr().(*net.TCPAddr))
+	if err != nil {
+		s.t.Fatalf("dial: %v", err)
+	}
+	s.t.Cleanup(func() { conn.Close() })
+	return &Client{Hostname: conn.RemoteAddr(), conn: conn}
+}
+
+// connect dials the server and performs the same handshake as Connect.
+func (s *mockServer) connect() (Client, error) {
+	conn, err := net.DialTCP("tcp", nil, s.listener.Addr().(*net.TCPAddr))
+	if err != nil {
+		s.t.Fatalf("dial: %v", err)
+	}
+	s.t.Cleanup(func() { conn.Close() })
+	return newClient(conn)
+}
+
+func (s *mockServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *mockServer) handle(conn net.Conn) {
+	defer func() { conn.Close() }()
+	reader := bufio.NewReader(conn)
+	usernameSet, passwordSet := false, false
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.TrimSuffix(line, "\n")
+		s.mu.Lock()
+		s.received = append(s.received, cmd)
+		if reader.Buffered() > 0 {
+			s.pipelined++
+		}
+		hook, tlsConfig, lineDelay := s.hook, s.tlsConfig, s.lineDelay
+		s.mu.Unlock()
+
+		var lines []string
+		handled := false
+		if hook != nil {
+			lines, handled = hook(cmd)
+		}
+		if !handled && strings.HasPrefix(cmd, "USERNAME ") {
+			lines, handled = []string{"OK"}, true
+			if usernameSet {
+				lines = []string{"ERR ALREADY-SET-USERNAME"}
+			}
+			usernameSet = true
+		}
+		if !handled && strings.HasPrefix(cmd, "PASSWORD ") {
+			lines, handled = []string{"OK"}, true
+			if passwordSet {
+				lines = []string{"ERR ALREADY-SET-PASSWORD"}
+			}
+			passwordSet = true
+		}
+		if !handled && cmd == "STARTTLS" {
+			if tlsConfig == nil {
+				lines = []string{"ERR FEATURE-NOT-CONFIGURED"}
+			} else {
+				if _, err := fmt.Fprint(conn, "OK STARTTLS\n"); err != nil {
+					return
+				}
+				tlsConn := tls.Server(conn, tlsConfig)
+				if err := tlsConn.Handshake(); err != nil {
+					return
+				}
+				conn, reader = tlsConn, bufio.NewReader(tlsConn)
+				continue
+			}
+		} else if !handled {
+			lines = s.respond(cmd)
+		}
+		for _, l := range lines {
+			if _, err := fmt.Fprintf(conn, "%s\n", l); err != nil {
+				return
+			}
+			time.Sleep(lineDelay)
+		}
+		if cmd == "LOGOUT" {
+			return
+		}
+	}
+}
+
+// splitMockCommand tokenizes a command line, honouring double quotes.
+func splitMockCommand(cmd string) []string {
+	args := []string{}
+	current := ""
+	quoted, inArg := false, false
+	for i := 0; i < len(cmd); i++ {
+		ch := cmd[i]
+		switch {
+		case ch == '\\' && quoted && i+1 < len(cmd):
+			i++
+			current += string(cmd[i])
+		case ch == '"':
+			quoted = !quoted
+			inArg = true
+		case ch == ' ' && !quoted:
+			if inArg {
+				args = append(args, current)
+			}
+			current, inArg = "", false
+		default:
+			current += string(ch)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, current)
+	}
+	return args
+}
+
+// escapeMockValue escapes backslashes and double quotes in a variable value, as upsd does when it sends one.
+func escapeMockValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (s *mockServer) respond(cmd string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	args := splitMockCommand(cmd)
+	if len(args) == 0 {
+		return []string{"ERR UNKNOWN-COMMAND"}
+	}
+	switch args[0] {
+	case "VER":
+		return []string{"Network UPS Tools upsd mock - http://www.networkupstools.org/"}
+	case "NETVER":
+		return []string{"1.2"}
+	case "HELP":
+		return []string{"Commands: HELP VER GET LIST SET INSTCMD LOGIN LOGOUT USERNAME PASSWORD STARTTLS"}
+	case "USERNAME", "PASSWORD":
+		return []string{"OK"}
+	case "LOGOUT":
+		return []string{"OK Goodbye"}
+	case "LIST":
+		return s.respondList(args)
+	case "GET":
+		return s.respondGet(args)
+	case "SET":
+		return s.respondSet(args)
+	}
+	if len(args) < 2 {
+		return []string{"ERR INVALID-ARGUMENT"}
+	}
+	ups, ok := s.ups[args[1]]
+	if !ok {
+		return []string{"ERR UNKNOWN-UPS"}
+	}
+	switch {
+	case args[0] == "MASTER" || args[0] == "PRIMARY":
+		return []string{"OK"}
+	case args[0] == "FSD":
+		return []string{"OK FSD-SET"}
+	case args[0] == "INSTCMD" && len(args) == 3:
+		for _, c := range ups.commands {
+			if c == args[2] {
+				return []string{"OK"}
+			}
+		}
+		return []string{"ERR CMD-NOT-SUPPORTED"}
+	}
+	return []string{"ERR UNKNOWN-COMMAND"}
+}
+
+func (s *mockServer) respondSet(args []string) []string {
+	if len(args) != 5 || args[1] != "VAR" {
+		return []string{"ERR INVALID-ARGUMENT"}
+	}
+	ups, ok := s.ups[args[2]]
+	if !ok {
+		return []string{"ERR UNKNOWN-UPS"}
+	}
+	if _, ok := ups.variables[args[3]]; !ok {
+		return []string{"ERR VAR-NOT-SUPPORTED"}
+	}
+	if !strings.HasPrefix(ups.types[args[3]], "RW") {
+		return []string{"ERR READONLY"}
+	}
+	ups.variables[args[3]] = args[4]
+	return []string{"OK"}
+}
+
+func (s *mockServer) respondList(args []string) []string {
+	if len(args) < 2 {
+		return []string{"ERR INVALID-ARGUMENT"}
+	}
+	if args[1] == "UPS" {
+		lines := []string{"BEGIN LIST UPS"}
+		for _, name := range s.upsNames {
+			lines = append(lines, fmt.Sprintf(`UPS %s "%s"`, name, s.ups[name].description))
+		}
+		return append(lines, "END LIST UPS")
+	}
+	if len(args) < 3 {
+		return []string{"ERR INVALID-ARGUMENT"}
+	}
+	ups, ok := s.ups[args[2]]
+	if !ok {
+		return []string{"ERR UNKNOWN-UPS"}
+	}
+	header := strings.Join(args[1:], " ")
+	lines := []string{"BEGIN LIST " + header}
+	switch args[1] {
+	case "VAR":
+		for _, name := range sortedKeys(ups.variables) {
+			lines = append(lines, fmt.Sprintf(`VAR %s %s "%s"`, args[2], name, escapeMockValue(ups.variables[name])))
+		}
+	case "RW":
+		for _, name := range sortedKeys(ups.variables) {
+			if strings.HasPrefix(ups.types[name], "RW") {
+				lines = append(lines, fmt.Sprintf(`RW %s %s "%s"`, args[2], name, escapeMockValue(ups.variables[name])))
+			}
+		}
+	case "CMD":
+		for _, name := range ups.commands {
+			lines = append(lines, fmt.Sprintf("CMD %s %s", args[2], name))
+		}
+	case "ENUM":
+		if len(args) != 4 {
+			return []string{"ERR INVALID-ARGUMENT"}
+		}
+		if _, ok := ups.variables[args[3]]; !ok {
+			return []string{"ERR VAR-NOT-SUPPORTED"}
+		}
+		for _, value := range ups.enums[args[3]] {
+			lines = append(lines, fmt.Sprintf(`ENUM %s %s "%s"`, args[2], args[3], value))
+		}
+	case "CLIENT":
+		for _, name := range ups.clients {
+			lines = append(lines, fmt.Sprintf("CLIENT %s %s", args[2], name))
+		}
+	default:
+		return []string{"ERR INVALID-ARGUMENT"}
+	}
+	return append(lines, "END LIST "+header)
+}
+
+func (s *mockServer) respondGet(args []string) []string {
+	if len(args) < 3 {
+		return []string{"ERR INVALID-ARGUMENT"}
+	}
+	ups, ok := s.ups[args[2]]
+	if !ok {
+		return []string{"ERR UNKNOWN-UPS"}
+	}
+	switch {
+	case args[1] == "NUMLOGINS":
+		return []string{fmt.Sprintf("NUMLOGINS %s %d", args[2], ups.numLogins)}
+	case args[1] == "UPSDESC":
+		return []string{fmt.Sprintf(`UPSDESC %s "%s"`, args[2], ups.description)}
+	case args[1] == "CMDDESC" && len(args) == 4:
+		return []string{fmt.Sprintf(`CMDDESC %s %s "Description unavailable"`, args[2], args[3])}
+	case len(args) == 4:
+		value, ok := ups.variables[args[3]]
+		if !ok {
+			return []string{"ERR VAR-NOT-SUPPORTED"}
+		}
+		switch args[1] {
+		case "VAR":
+			return []string{fmt.Sprintf(`VAR %s %s "%s"`, args[2], args[3], escapeMockValue(value))}
+		case "DESC":
+			return []string{fmt.Sprintf(`DESC %s %s "Description unavailable"`, args[2], args[3])}
+		case "TYPE":
+			varType := ups.types[args[3]]
+			if varType == "" {
+				varType = "NUMBER"
+			}
+			return []string{fmt.Sprintf("TYPE %s %s %s", args[2], args[3], varType)}
+		}
+	}
+	return []string{"ERR INVALID-ARGUMENT"}
+}
+
+func TestFlatSnapshot(t *testing.T) {
+	server := newMockServer(t)
+	server.addUPS("alpha", "First", map[string]string{"battery.charge": "100", "ups.status": "OL"})
+	server.addUPS("beta", "Second", map[string]string{"battery.charge": "42", "ups.status": "OB DISCHRG"})
+	client := server.client()
+
+	snapshot, err := client.FlatSnapshot()
+	if err != nil {
+		t.Fatalf("FlatSnapshot: %v", err)
+	}
+	expected := map[string]string{
+		"alpha.battery.charge": "100",
+		"alpha.ups.status":     "OL",
+		"beta.battery.charge":  "42",
+		"beta.ups.status":      "OB DISCHRG",
+	}
+	if len(snapshot) != len(expected) {
+		t.Fatalf("expected %d keys, got %d: %v", len(expected), len(snapshot), snapshot)
+	}
+	for key, value := range expected {
+		if snapshot[key] != value {
+			t.Errorf("%s: expected %q, got %q", key, value, snapshot[key])
+		}
+	}
+}
+
+func TestConnectRejectsNonNUTServer(t *testing.T) {
+	replies := map[string]string{
+		"http":   "HTTP/1.1 400 Bad Request",
+		"binary": "\x30\x82\x01\x00\x02\x01\x00\xa2",
+	}
+	for name, reply := range replies {
+		reply := reply
+		t.Run(name, func(t *testing.T) {
+			server := newMockServer(t)
+			server.hook = func(cmd string) ([]string, bool) {
+				return []string{reply}, true
+			}
+			if _, err := server.connect(); err != ErrNotNUTServer {
+				t.Fatalf("expected ErrNotNUTServer, got %v", err)
+			}
+		})
+	}
+}
+
+// rawServer accepts a single connection, writes reply as soon as the first command arrives, and then keeps the connection open without sending anything else.
+// Unlike mockServer it sends reply exactly as given, without a trailing newline.
+func rawServer(t *testing.T, reply string) *net.TCPConn {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		t.Cleanup(func() { conn.Close() })
+		bufio.NewReader(conn).ReadString('\n')
+		fmt.Fprint(conn, reply)
+	}()
+	conn, err := net.DialTCP("tcp", nil, listener.Addr().(*net.TCPAddr))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestConnectRejectsBinaryWithoutNewline(t *testing.T) {
+	start := time.Now()
+	if _, err := newClient(rawServer(t, "\x16\x03\x01\x00\xa5\x01\x00\x00")); err != ErrNotNUTServer {
+		t.Fatalf("expected ErrNotNUTServer, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected the blob to be rejected without waiting for a newline, took %v", elapsed)
+	}
+}
+
+func TestConnectTimesOutOnSilentServer(t *testing.T) {
+	defer func(timeout time.Duration) { handshakeTimeout = timeout }(handshakeTimeout)
+	handshakeTimeout = 50 * time.Millisecond
+
+	for name, reply := range map[string]string{"silent": "", "partial line": "Network UPS Tools upsd"} {
+		_, err := newClient(rawServer(t, reply))
+		var netErr net.Error
+		if !errors.As(err, &netErr) || !netErr.Timeout() {
+			t.Errorf("%s: expected a timeout, got %v", name, err)
+		}
+	}
+}
+
+func TestConnectAcceptsNUTServer(t *testing.T) {
+	server := newMockServer(t)
+	client, err := server.connect()
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	if client.ProtocolVersion != "1.2" {
+		t.Errorf("expected protocol version 1.2, got %q", client.ProtocolVersion)
+	}
+}
+
+// fakeClock is a manually advanced time source for deterministic time-based tests.
+type fakeClock struct {
+	mu      sync.Mutex
+	current time.Time
+	step    time.Duration
+}
+
+// now returns the current fake time, then advances it by step.
+func (f *fakeClock) now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	current := f.current
+	f.current = f.current.Add(f.step)
+	return current
+}
+
+func (f *fakeClock) advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.current = f.current.Add(d)
+}
+
+func TestClientClock(t *testing.T) {
+	client := &Client{}
+	if since := time.Since(client.clock()); since < 0 || since > time.Minute {
+		t.Fatalf("expected default clock to follow time.Now, off by %v", since)
+	}
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	fake := &fakeClock{current: start}
+	client.now = fake.now
+	fake.advance(time.Hour)
+	if got := client.clock(); !got.Equal(start.Add(time.Hour)) {
+		t.Fatalf("expected injected clock time %v, got %v", start.Add(time.Hour), got)
+	}
+}
+
+func TestLatencyUsesClientClock(t *testing.T) {
+	server := newMockServer(t)
+	client := server.client()
+	// Each reading of the fake clock moves it on by 250ms, so the measured round trip is exact without any sleeping.
+	client.now = (&fakeClock{current: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), step: 250 * time.Millisecond}).now
+
+	latency, err := client.Latency()
+	if err != nil {
+		t.Fatalf("Latency: %v", err)
+	}
+	if latency != 250*time.Millisecond {
+		t.Errorf("expected the latency measured on the fake clock, got %v", latency)
+	}
+}
+
+func TestNormalizeVariableNames(t *testing.T) {
+	server := newMockServer(t)
+	server.addUPS("vendor", "", map[string]string{"Battery.Charge": "80"})
+	client := server.client()
+
+	snapshot, err := client.FlatSnapshot()
+	if err != nil {
+		t.Fatalf("FlatSnapshot: %v", err)
+	}
+	if snapshot["vendor.Battery.Charge"] != "80" {
+		t.Fatalf("expected wire name to be preserved by default, got %v", snapshot)
+	}
+
+	client.NormalizeVariableNames = true
+	ups := UPS{Name: "vendor", nutClient: client}
+	variables, err := ups.GetVariables()
+	if err != nil {
+		t.Fatalf("GetVariables: %v", err)
+	}
+	if len(variables) != 1 || variables[0].Name != "battery.charge" {
+		t.Fatalf("expected normalized battery.charge, got %+v", variables)
+	}
+	snapshot, err = client.FlatSnapshot()
+	if err != nil {
+		t.Fatalf("FlatSnapshot: %v", err)
+	}
+	if snapshot["vendor.battery.charge"] != "80" {
+		t.Errorf("expected normalized key in snapshot, got %v", snapshot)
+	}
+}
+
+func TestServerVersions(t *testing.T) {
+	old := newMockServer(t)
+	old.hook = func(cmd string) ([]string, bool) {
+		switch cmd {
+		case "VER":
+			return []string{"Network UPS Tools upsd 2.7.4 - http://www.networkupstools.org/"}, true
+		case "NETVER":
+			return []string{"1.2"}, true
+		}
+		return nil, false
+	}
+	current := newMockServer(t)
+	current.hook = func(cmd string) ([]string, bool) {
+		switch cmd {
+		case "VER":
+			return []string{"Network UPS Tools upsd 2.8.1 - https://www.networkupstools.org/"}, true
+		case "NETVER":
+			return []string{"1.3"}, true
+		}
+		return nil, false
+	}
+	unreachable := newMockServer(t)
+	broken := unreachable.client()
+	broken.conn.Close()
+
+	// Two clients of the same server must not overwrite each other, and a client without an address still gets an entry.
+	oldClient, currentClient, sameServer := old.client(), current.client(), current.client()
+	sameServer.Hostname = nil
+	versions := ServerVersions([]*Client{oldClient, currentClient, broken, sameServer})
+	if len(versions) != 4 {
+		t.Fatalf("expected 4 entries, got %v", versions)
+	}
+	if v := versions[0]; v.Err != nil || v.Server != oldClient.Hostname.String() || v.ProtocolVersion != "1.2" || !strings.Contains(v.Version, "2.7.4") {
+		t.Errorf("unexpected result for old server: %+v", v)
+	}
+	for _, v := range []ServerVersion{versions[1], versions[3]} {
+		if v.Err != nil || v.ProtocolVersion != "1.3" || !strings.Contains(v.Version, "2.8.1") {
+			t.Errorf("unexpected result for current server: %+v", v)
+		}
+	}
+	if v := versions[2]; v.Err == nil {
+		t.Errorf("expected an error for the closed client, got %+v", v)
+	}
+}
+
+func TestConnectServerVersions(t *testing.T) {
+	old, current := newMockServer(t), newMockServer(t)
+	old.hook = func(cmd string) ([]string, bool) {
+		if cmd == "NETVER" {
+			return []string{"1.2"}, true
+		}
+		return nil, false
+	}
+	current.hook = func(cmd string) ([]string, bool) {
+		if cmd == "NETVER" {
+			return []string{"1.3"}, true
+		}
+		return nil, false
+	}
+	servers := map[string]*mockServer{"old": old, "current": current}
+	connect := func(hostname string) (Client, error) {
+		server, ok := servers[hostname]
+		if !ok {
+			return Client{}, fmt.Errorf("dial %s: connection refused", hostname)
+		}
+		return server.connect()
+	}
+
+	versions := connectServerVersions([]string{"old", "unreachable", "current", "old"}, connect)
+	expected := []struct{ server, protocolVersion string }{{"old", "1.2"}, {"unreachable", ""}, {"current", "1.3"}, {"old", "1.2"}}
+	if len(versions) != len(expected) {
+		t.Fatalf("expected %d entries, got %+v", len(expected), versions)
+	}
+	for i, e := range expected {
+		v := versions[i]
+		if v.Server != e.server || v.ProtocolVersion != e.protocolVersion || (v.Err != nil) != (e.server == "unreachable") {
+			t.Errorf("entry %d: expected %s with protocol %q, got %+v", i, e.server, e.protocolVersion, v)
+		}
+	}
+}
+
+func TestRewriteCommand(t *testing.T) {
+	server := newMockServer(t)
+	server.addUPS("ups", "", nil)
+	client := server.client()
+	client.RewriteCommand = func(cmd string) string {
+		if strings.HasPrefix(cmd, "MASTER ") {
+			return "PRIMARY " + strings.TrimPrefix(cmd, "MASTER ")
+		}
+		return cmd
+	}
+	ups := UPS{Name: "ups", nutClient: client}
+	master, err := ups.CheckIfMaster()
+	if err != nil || !master {
+		t.Fatalf("CheckIfMaster: %v, %v", master, err)
+	}
+	if received := server.commands(); len(received) != 1 || received[0] != "PRIMARY ups" {
+		t.Errorf("expected the rewritten command to be sent, got %q", received)
+	}
+}
+
+func TestAllCommands(t *testing.T) {
+	server := newMockServer(t)
+	server.addUPS("alpha", "", nil).commands = []string{"beeper.toggle", "test.battery.start"}
+	server.addUPS("beta", "", nil).commands = []string{"load.off"}
+	server.addUPS("stale", "", nil)
+	server.hook = func(cmd string) ([]string, bool) {
+		if cmd == "LIST CMD stale" {
+			return []string{"ERR DATA-STALE"}, true
+		}
+		return nil, false
+	}
+
+	commands, upsErrors, err := server.client().AllCommands()
+	if err != nil {
+		t.Fatalf("AllCommands: %v", err)
+	}
+	if len(commands["alpha"]) != 2 || commands["alpha"][1].Name != "test.battery.start" {
+		t.Errorf("unexpected commands for alpha: %+v", commands["alpha"])
+	}
+	if len(commands["beta"]) != 1 || commands["beta"][0].Name != "load.off" || commands["beta"][0].Description != "Description unavailable" {
+		t.Errorf("unexpected commands for beta: %+v", commands["beta"])
+	}
+	if _, ok := commands["stale"]; ok || upsErrors["stale"] != ErrDataStale {
+		t.Errorf("expected stale UPS to be recorded as an error, got %v", upsErrors)
+	}
+	// alpha's second GET CMDDESC is sent together with the first instead of waiting for its reply.
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if server.pipelined != 1 {
+		t.Errorf("expected the GET CMDDESC queries to be pipelined, got %d pipelined commands", server.pipelined)
+	}
+}
+
+func TestSendPipelinedErrors(t *testing.T) {
+	server := newMockServer(t)
+	server.addUPS("ups", "", map[string]string{"ups.status": "OL"})
+
+	replies, errs, err := server.client().sendPipelined([]string{"GET VAR ups ups.status", "GET VAR ups ups.load", "GET VAR ups ups.status"})
+	if err != nil {
+		t.Fatalf("sendPipelined: %v", err)
+	}
+	if replies[0] != `VAR ups ups.status "OL"` || replies[2] != replies[0] {
+		t.Errorf("unexpected replies %q", replies)
+	}
+	if errs[0] != nil || errs[1] != ErrVarNotSupported || errs[2] != nil {
+		t.Errorf("expected only the second command to fail, got %v", errs)
+	}
+}
+
+func TestParseUPSLine(t *testing.T) {
+	cases := []struct {
+		line, name, description string
+	}{
+		{`UPS myups "Rack A UPS"`, "myups", "Rack A UPS"},
+		{`UPS bare`, "bare", ""},
+		{`UPS empty ""`, "empty", ""},
+	}
+	for _, c := range cases {
+		name, description := parseUPSLine(c.line)
+		if name != c.name || description != c.description {
+			t.Errorf("%q: expected (%q, %q), got (%q, %q)", c.line, c.name, c.description, name, description)
+		}
+	}
+}
+
+func TestGetUPSListWithoutDescriptions(t *testing.T) {
+	server := newMockServer(t)
+	server.addUPS("described", "Rack A", nil)
+	server.addUPS("bare", "", nil)
+	server.hook = func(cmd string) ([]string, bool) {
+		if cmd == "LIST UPS" {
+			return []string{"BEGIN LIST UPS", `UPS described "Rack A"`, "UPS bare", "END LIST UPS"}, true
+		}
+		return nil, false
+	}
+
+	upsList, err := server.client().GetUPSList()
+	if err != nil {
+		t.Fatalf("GetUPSList: %v", err)
+	}
+	if len(upsList) != 2 || upsList[0].Name != "described" || upsList[1].Name != "bare" {
+		t.Fatalf("unexpected UPS list: %+v", upsList)
+	}
+	if upsList[0].Description != "Rack A" || upsList[1].Description != "" {
+		t.Errorf("unexpected descriptions %q and %q", upsList[0].Description, upsList[1].Description)
+	}
+	// The descriptions, including the missing one, come from LIST UPS alone.
+	for _, cmd := range server.commands() {
+		if strings.HasPrefix(cmd, "GET UPSDESC ") {
+			t.Errorf("expected no GET UPSDESC, got %q", cmd)
+		}
+	}
+}
+
+func TestConnectServerBusy(t *testing.T) {
+	// Like upsd at MAXCONN, accept connections and close them straight away.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	conn, err := net.DialTCP("tcp", nil, listener.Addr().(*net.TCPAddr))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	if _, err := newClient(conn); err != ErrServerBusy {
+		t.Fatalf("expected ErrServerBusy, got %v", err)
+	}
+}
+
+func TestReadOnlyClient(t *testing.T) {
+	server := newMockServer(t)
+	mock := server.addUPS("ups", "", map[string]string{"ups.status": "OL", "input.sensitivity": "normal"})
+	mock.types["input.sensitivity"] = "RW ENUM"
+	mock.commands = []string{"beeper.toggle"}
+	client := server.client()
+	client.ReadOnly = true
+	ups := UPS{Name: "ups", nutClient: client}
+
+	mutations := map[string]func() error{
+		"SetVariable": func() error {
+			_, err := ups.SetVariable("input.sensitivity", "high")
+			return err
+		},
+		"SendCommand": func() error {
+			_, err := ups.SendCommand("beeper.toggle")
+			return err
+		},
+		"ForceShutdown": func() error {
+			_, err := ups.ForceShutdown()
+			return err
+		},
+		"SetSensitivity": func() error {
+			_, err := ups.SetSensitivity("high")
+			return err
+		},
+		"ImportConfig": func() error {
+			_, err := ups.ImportConfig(map[string]string{"input.sensitivity": "high"})
+			return err
+		},
+	}
+	// Raw commands are blocked however they are spelled, since upsd ignores case and leading whitespace.
+	for _, cmd := range []string{"set var ups input.sensitivity high", " FSD ups", "\tInstCmd ups beeper.toggle"} {
+		cmd := cmd
+		mutations["SendCommand "+cmd] = func() error {
+			_, err := client.SendCommand(cmd)
+			return err
+		}
+	}
+	for name, mutate := range mutations {
+		if err := mutate(); !errors.Is(err, ErrReadOnlyClient) {
+			t.Errorf("%s: expected ErrReadOnlyClient, got %v", name, err)
+		}
+	}
+	for _, cmd := range server.commands() {
+		if isMutatingCommand(cmd) {
+			t.Errorf("expected no mutating commands on the wire, got %q", cmd)
+		}
+	}
+
+	if status, err := ups.getVariableValue("ups.status"); err != nil || status != "OL" {
+		t.Errorf("expected reads to work, got %q, %v", status, err)
+	}
+}
+
+func TestSendCommandContextCancelledMidList(t *testing.T) {
+	server := newMockServer(t)
+	variables := map[string]string{}
+	for i := 0; i < 1000; i++ {
+		variables[fmt.Sprintf("vendor.var%04d", i)] = "value"
+	}
+	server.addUPS("huge", "", variables)
+	server.lineDelay = time.Millisecond
+	client := server.client()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	_, err := client.SendCommandContext(ctx, "LIST VAR huge")
+	if err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("expected the read to stop promptly after cancellation, took %v", elapsed)
+	}
+}
+
+func TestSendCommandContextResetsDeadline(t *testing.T) {
+	server := newMockServer(t)
+	server.addUPS("ups", "", map[string]string{"ups.status": "OL"})
+	client := server.client()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	if _, err := client.SendCommandContext(ctx, "GET VAR ups ups.status"); err != nil {
+		t.Fatalf("SendCommandContext: %v", err)
+	}
+	cancel()
+	// The cancelled context must not leave a deadline behind for later commands.
+	if _, err := client.SendCommand("GET VAR ups ups.status"); err != nil {
+		t.Fatalf("SendCommand after cancel: %v", err)
+	}
+}
+
+func TestAllVariables(t *testing.T) {
+	server := newMockServer(t)
+	server.addUPS("alpha", "", map[string]string{"battery.charge": "100", "ups.status": "OL"})
+	server.addUPS("beta", "", map[string]string{"ups.status": "OB"})
+	server.addUPS("stale", "", map[string]string{"ups.status": "OL"})
+	server.hook = func(cmd string) ([]string, bool) {
+		if cmd == "LIST VAR stale" {
+			return []string{"ERR DATA-STALE"}, true
+		}
+		return nil, false
+	}
+
+	variables, upsErrors, err := server.client().AllVariables()
+	if err != nil {
+		t.Fatalf("AllVariables: %v", err)
+	}
+	expected := []OwnedVariable{
+		{UPS: "alpha", Name: "battery.charge", Value: "100"},
+		{UPS: "alpha", Name: "ups.status", Value: "OL"},
+		{UPS: "beta", Name: "ups.status", Value: "OB"},
+	}
+	if len(variables) != len(expected) {
+		t.Fatalf("expected %+v, got %+v", expected, variables)
+	}
+	for i := range expected {
+		if variables[i] != expected[i] {
+			t.Errorf("variable %d: expected %+v, got %+v", i, expected[i], variables[i])
+		}
+	}
+	if len(upsErrors) != 1 || upsErrors["stale"] != ErrDataStale {
+		t.Errorf("expected the stale UPS to be recorded, got %v", upsErrors)
+	}
+}
+
+func TestErrorInsideList(t *testing.T) {
+	server := newMockServer(t)
+	server.addUPS("ups", "", map[string]string{"ups.status": "OL"})
+	server.hook = func(cmd string) ([]string, bool) {
+		if cmd == "LIST VAR ups" {
+			return []string{"BEGIN LIST VAR ups", `VAR ups battery.charge "100"`, "ERR DRIVER-NOT-CONNECTED", "END LIST VAR ups"}, true
+		}
+		return nil, false
+	}
+
+	ups := testUPS(server, "ups")
+	if _, _, err := ups.getRawVariables(); err != ErrDriverNotConnected {
+		t.Fatalf("expected ErrDriverNotConnected, got %v", err)
+	}
+	// The rest of the aborted list must not be taken as the reply to the next command.
+	version, err := ups.nutClient.GetVersion()
+	if err != nil || !strings.HasPrefix(version, "Network UPS Tools upsd mock") {
+		t.Errorf("expected the next command to get its own reply, got %q, %v", version, err)
+	}
+}
+
+func TestMaxResponseBytes(t *testing.T) {
+	server := newMockServer(t)
+	server.addUPS("ups", "", map[string]string{"ups.status": "OL"})
+	server.hook = func(cmd string) ([]string, bool) {
+		if cmd != "LIST VAR flood" {
+			return nil, false
+		}
+		lines := []string{"BEGIN LIST VAR flood"}
+		for i := 0; i < 2000; i++ {
+			lines = append(lines, fmt.Sprintf(`VAR flood vendor.field%d "value"`, i))
+		}
+		return append(lines, "END LIST VAR flood"), true
+	}
+
+	client := server.client()
+	client.MaxResponseBytes = 4096
+	if _, err := client.SendCommand("LIST VAR ups"); err != nil {
+		t.Fatalf("expected a small response to be allowed, got %v", err)
+	}
+	if _, err := client.SendCommand("LIST VAR flood"); err != ErrResponseTooLarge {
+		t.Fatalf("expected ErrResponseTooLarge, got %v", err)
+	}
+}
+
+func TestBuildCommand(t *testing.T) {
+	cmd, err := BuildCommand("SET", "VAR", "myups", "ups.id", `Rack "A" \ top`)
+	if err != nil {
+		t.Fatalf("BuildCommand: %v", err)
+	}
+	if expected := `SET VAR myups ups.id "Rack \"A\" \\ top"`; cmd != expected {
+		t.Errorf("expected %s, got %s", expected, cmd)
+	}
+	if args := splitMockCommand(cmd); len(args) != 5 || args[4] != `Rack "A" \ top` {
+		t.Errorf("expected the value to round-trip through the server's tokenizer, got %q", args)
+	}
+	if cmd, err := BuildCommand("GET", "VAR", "myups", "ups.status"); err != nil || cmd != "GET VAR myups ups.status" {
+		t.Errorf("expected plain parts to be left unquoted, got %q, %v", cmd, err)
+	}
+	if _, err := BuildCommand("SET", "VAR", "myups", "ups.id", "evil\nFSD myups"); err == nil {
+		t.Error("expected a part containing a newline to be rejected")
+	}
+}
+
+func TestUnsolicitedLines(t *testing.T) {
+	server := newMockServer(t)
+	server.addUPS("ups", "", map[string]string{"ups.status": "OL", "battery.charge": "100"})
+	server.hook = func(cmd string) ([]string, bool) {
+		switch cmd {
+		case "GET VAR ups ups.status":
+			return []string{"NOTICE upsd will restart in 5 minutes", `VAR ups ups.status "OL"`}, true
+		case "LIST VAR ups":
+			return []string{"BEGIN LIST VAR ups", `VAR ups battery.charge "100"`, "NOTICE still here", `VAR ups ups.status "OL"`, "END LIST VAR ups"}, true
+		}
+		return nil, false
+	}
+	ups := testUPS(server, "ups")
+	notices := []string{}
+	ups.nutClient.OnUnsolicited = func(line string) { notices = append(notices, line) }
+
+	status, err := ups.getVariableValue("ups.status")
+	if err != nil || status != "OL" {
+		t.Fatalf("expected the real response to parse, got %q, %v", status, err)
+	}
+	names, values, err := ups.getRawVariables()
+	if err != nil || len(names) != 2 || values["ups.status"] != "OL" {
+		t.Fatalf("expected the list to parse without the notice, got %v, %v", values, err)
+	}
+	if len(notices) != 2 || notices[0] != "NOTICE upsd will restart in 5 minutes" || notices[1] != "NOTICE still here" {
+		t.Errorf("expected both notices to reach the callback, got %q", notices)
+	}
+
+	// Without a callback the notice is dropped silently.
+	ups.nutClient.OnUnsolicited = nil
+	if status, err := ups.getVariableValue("ups.status"); err != nil || status != "OL" {
+		t.Errorf("expected the real response to parse, got %q, %v", status, err)
+	}
+}
+
+func TestFreeFormRepliesAreNotFiltered(t *testing.T) {
+	server := newMockServer(t)
+	server.addUPS("ups", "", map[string]string{"ups.status": "OL"})
+	server.hook = func(cmd string) ([]string, bool) {
+		switch cmd {
+		case "GET TRACKING":
+			return []string{"ON"}, true
+		case "GET TRACKING 1bd31808-cb49-4aec-9d75-d056e6f018d2":
+			return []string{"SUCCESS"}, true
+		case "GET FUTURE ups":
+			return []string{"42"}, true
+		}
+		return nil, false
+	}
+	client := server.client()
+	for cmd, want := range map[string]string{
+		"GET TRACKING": "ON",
+		"GET TRACKING 1bd31808-cb49-4aec-9d75-d056e6f018d2": "SUCCESS",
+		"GET FUTURE ups": "42",
+	} {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		resp, err := client.SendCommandContext(ctx, cmd)
+		cancel()
+		if err != nil || len(resp) != 1 || resp[0] != want {
+			t.Errorf("%s: expected %q, got %q, %v", cmd, want, resp, err)
+		}
+	}
+}
+
+func TestLatency(t *testing.T) {
+	server := newMockServer(t)
+	server.hook = func(cmd string) ([]string, bool) {
+		if cmd == "VER" {
+			time.Sleep(20 * time.Millisecond)
+		}
+		return nil, false
+	}
+	client := server.client()
+	client.Version = "before"
+
+	latency, err := client.Latency()
+	if err != nil {
+		t.Fatalf("Latency: %v", err)
+	}
+	if latency < 20*time.Millisecond || latency > 2*time.Second {
+		t.Errorf("expected a latency of at least the server delay, got %v", latency)
+	}
+	if client.Version != "before" {
+		t.Errorf("expected Latency not to change Version, got %q", client.Version)
+	}
+}
+
+func TestListUPSMatching(t *testing.T) {
+	server := newMockServer(t)
+	for _, name := range []string{"rack-a-1", "rack-a-2", "rack-b-1", "office"} {
+		server.addUPS(name, "", nil)
+	}
+	client := server.client()
+
+	names := func(upsList []UPS) string {
+		list := []string{}
+		for _, ups := range upsList {
+			list = append(list, ups.Name)
+		}
+		return strings.Join(list, ",")
+	}
+
+	upsList, err := client.ListUPSMatching("rack-a-*")
+	if err != nil {
+		t.Fatalf("ListUPSMatching: %v", err)
+	}
+	if got := names(upsList); got != "rack-a-1,rack-a-2" {
+		t.Errorf("expected rack-a-1,rack-a-2, got %s", got)
+	}
+
+	upsList, err = client.ListUPSMatchingRegexp(`^rack-[ab]-1$`)
+	if err != nil {
+		t.Fatalf("ListUPSMatchingRegexp: %v", err)
+	}
+	if got := names(upsList); got != "rack-a-1,rack-b-1" {
+		t.Errorf("expected rack-a-1,rack-b-1, got %s", got)
+	}
+
+	if _, err := client.ListUPSMatching("rack-["); err == nil {
+		t.Error("expected an invalid glob to be rejected")
+	}
+	for _, cmd := range server.commands() {
+		if strings.HasSuffix(cmd, " office") {
+			t.Errorf("expected non-matching UPSes not to be queried, got %q", cmd)
+		}
+	}
+}
+
+func TestAuthenticateRetryAfterRejectedPassword(t *testing.T) {
+	server := newMockServer(t)
+	server.addUPS("ups", "", map[string]string{"ups.status": "OL"})
+	server.hook = func(cmd string) ([]string, bool) {
+		if cmd == "PASSWORD wrong" {
+			return []string{"ERR INVALID-PASSWORD"}, true
+		}
+		return nil, false
+	}
+	client := server.client()
+
+	if ok, err := client.Authenticate("monuser", "wrong"); ok || err != ErrInvalidPassword {
+		t.Fatalf("expected ErrInvalidPassword, got %v, %v", ok, err)
+	}
+	if ok, err := client.Authenticate("admin", "secret"); ok || err != ErrAlreadySetUsername {
+		t.Errorf("expected ErrAlreadySetUsername once upsd has accepted another username, got %v, %v", ok, err)
+	}
+	if ok, err := client.Authenticate("monuser", "secret"); err != nil || !ok {
+		t.Fatalf("expected the retry with the correct password to succeed, got %v, %v", ok, err)
+	}
+	logins := 0
+	for _, cmd := range server.commands() {
+		if strings.HasPrefix(cmd, "USERNAME ") {
+			logins++
+		}
+	}
+	if logins != 1 {
+		t.Errorf("expected USERNAME to be sent once, got %d", logins)
+	}
+}
+
+func TestAuthenticateTwice(t *testing.T) {
+	server := newMockServer(t)
+	server.addUPS("ups", "", map[string]string{"ups.status": "OL"})
+	client := server.client()
+
+	for i := 0; i < 2; i++ {
+		if ok, err := client.Authenticate("monuser", "secret"); err != nil || !ok {
+			t.Fatalf("Authenticate attempt %d: %v, %v", i+1, ok, err)
+		}
+	}
+	if ok, err := client.Authenticate("admin", "other"); ok || err != ErrAlreadySetUsername {
+		t.Errorf("expected ErrAlreadySetUsername for different credentials, got %v, %v", ok, err)
+	}
+	if ok, err := client.Authenticate("monuser", "guessed"); ok || err != ErrAlreadySetPassword {
+		t.Errorf("expected ErrAlreadySetPassword for a different password, got %v, %v", ok, err)
+	}
+	logins := 0
+	for _, cmd := range server.commands() {
+		if strings.HasPrefix(cmd, "USERNAME ") {
+			logins++
+		}
+	}
+	if logins != 1 {
+		t.Errorf("expected USERNAME to be sent once, got %d", logins)
+	}
+
+	// The session must still be usable afterwards.
+	ups := UPS{Name: "ups", nutClient: client}
+	if status, err := ups.getVariableValue("ups.status"); err != nil || status != "OL" {
+		t.Errorf("expected the session to keep working, got %q, %v", status, err)
+	}
+}
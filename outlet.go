@@ -0,0 +1,75 @@
+package nut
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Outlet is a single outlet of a UPS or PDU, identified by the N in its outlet.N.* variables.
+type Outlet struct {
+	Number      int
+	Description string
+	ups         *UPS
+}
+
+// GetOutlets returns the numbered outlets of the UPS, found from its outlet.N.* variables, in ascending order.
+func (u *UPS) GetOutlets() ([]Outlet, error) {
+	outlets := []Outlet{}
+	_, values, err := u.getRawVariables()
+	if err != nil {
+		return outlets, err
+	}
+	seen := map[int]bool{}
+	for name := range values {
+		splitName := strings.SplitN(name, ".", 3)
+		if len(splitName) < 3 || splitName[0] != "outlet" {
+			continue
+		}
+		number, err := strconv.Atoi(splitName[1])
+		if err != nil || seen[number] {
+			continue
+		}
+		seen[number] = true
+		outlets = append(outlets, Outlet{
+			Number:      number,
+			Description: values[fmt.Sprintf("outlet.%d.desc", number)],
+			ups:         u,
+		})
+	}
+	sort.Slice(outlets, func(i, j int) bool { return outlets[i].Number < outlets[j].Number })
+	return outlets, nil
+}
+
+// variableName returns the name of the outlet.N.<name> variable for this outlet.
+func (o Outlet) variableName(name string) string {
+	return fmt.Sprintf("outlet.%d.%s", o.Number, name)
+}
+
+// Power returns the power drawn through the outlet (outlet.N.power).
+// If the outlet does not measure it, ErrVarNotSupported is returned.
+func (o Outlet) Power() (float64, error) {
+	return o.ups.getFloatVariable(o.variableName("power"))
+}
+
+// Current returns the current drawn through the outlet in amperes (outlet.N.current).
+// If the outlet does not measure it, ErrVarNotSupported is returned.
+func (o Outlet) Current() (float64, error) {
+	return o.ups.getFloatVariable(o.variableName("current"))
+}
+
+// AutoSwitchChargeLow returns the battery charge percentage below which the outlet is switched off to shed load (outlet.N.autoswitch.charge.low).
+// If the outlet does not support it, ErrVarNotSupported is returned.
+func (o Outlet) AutoSwitchChargeLow() (float64, error) {
+	return o.ups.getFloatVariable(o.variableName("autoswitch.charge.low"))
+}
+
+// SetAutoSwitchChargeLow sets outlet.N.autoswitch.charge.low to pct, which must be between 0 and 100.
+// An out-of-range value is rejected without sending a SET to upsd.
+func (o Outlet) SetAutoSwitchChargeLow(pct float64) (bool, error) {
+	if pct < 0 || pct > 100 {
+		return false, fmt.Errorf("invalid charge percentage %v: must be between 0 and 100", pct)
+	}
+	return o.ups.SetVariable(o.variableName("autoswitch.charge.low"), strconv.FormatFloat(pct, 'f', -1, 64))
+}
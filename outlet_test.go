@@ -0,0 +1,69 @@
+package nut
+
+import "testing"
+
+func TestOutlets(t *testing.T) {
+	server := newMockServer(t)
+	server.addUPS("pdu", "", map[string]string{
+		"outlet.desc":          "Main outlet",
+		"outlet.1.desc":        "Switch",
+		"outlet.1.power":       "35.5",
+		"outlet.1.current":     "0.16",
+		"outlet.2.desc":        "Server",
+		"outlet.2.status":      "on",
+		"outlet.10.switchable": "yes",
+	})
+
+	outlets, err := testUPS(server, "pdu").GetOutlets()
+	if err != nil {
+		t.Fatalf("GetOutlets: %v", err)
+	}
+	if len(outlets) != 3 || outlets[0].Number != 1 || outlets[1].Number != 2 || outlets[2].Number != 10 {
+		t.Fatalf("expected outlets 1, 2 and 10, got %+v", outlets)
+	}
+	if outlets[0].Description != "Switch" || outlets[1].Description != "Server" {
+		t.Errorf("unexpected descriptions %q and %q", outlets[0].Description, outlets[1].Description)
+	}
+
+	if power, err := outlets[0].Power(); err != nil || power != 35.5 {
+		t.Errorf("expected 35.5W, got %v, %v", power, err)
+	}
+	if current, err := outlets[0].Current(); err != nil || current != 0.16 {
+		t.Errorf("expected 0.16A, got %v, %v", current, err)
+	}
+	if _, err := outlets[1].Power(); err != ErrVarNotSupported {
+		t.Errorf("expected ErrVarNotSupported for an unmetered outlet, got %v", err)
+	}
+}
+
+func TestOutletAutoSwitchChargeLow(t *testing.T) {
+	server := newMockServer(t)
+	mock := server.addUPS("pdu", "", map[string]string{
+		"outlet.1.autoswitch.charge.low": "30",
+		"outlet.2.desc":                  "Server",
+	})
+	mock.types = map[string]string{"outlet.1.autoswitch.charge.low": "RW NUMBER"}
+	ups := testUPS(server, "pdu")
+	shedding, critical := Outlet{Number: 1, ups: ups}, Outlet{Number: 2, ups: ups}
+
+	if pct, err := shedding.AutoSwitchChargeLow(); err != nil || pct != 30 {
+		t.Errorf("expected 30, got %v, %v", pct, err)
+	}
+	if _, err := critical.AutoSwitchChargeLow(); err != ErrVarNotSupported {
+		t.Errorf("expected ErrVarNotSupported, got %v", err)
+	}
+
+	if ok, err := shedding.SetAutoSwitchChargeLow(45); err != nil || !ok {
+		t.Fatalf("SetAutoSwitchChargeLow: %v, %v", ok, err)
+	}
+	if pct, err := shedding.AutoSwitchChargeLow(); err != nil || pct != 45 {
+		t.Errorf("expected 45 after SET, got %v, %v", pct, err)
+	}
+	before := len(server.commands())
+	if _, err := shedding.SetAutoSwitchChargeLow(120); err == nil {
+		t.Error("expected an error for a charge above 100")
+	}
+	if len(server.commands()) != before {
+		t.Error("an out-of-range charge was sent to upsd")
+	}
+}
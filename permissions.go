@@ -0,0 +1,101 @@
+package nut
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Operation is a kind of request whose permission CheckPermissions can estimate.
+type Operation int
+
+// Operations understood by CheckPermissions.
+const (
+	OperationRead Operation = iota
+	OperationSet
+	OperationInstCmd
+	OperationFSD
+)
+
+func (o Operation) String() string {
+	switch o {
+	case OperationSet:
+		return "set"
+	case OperationInstCmd:
+		return "instcmd"
+	case OperationFSD:
+		return "fsd"
+	}
+	return "read"
+}
+
+// CheckPermissions estimates which of ops this session may perform on the UPS, without changing any state.
+//
+// upsd offers no way to query its access control, so only OperationRead is actually probed, with GET VAR ups.status.
+// The others are inferred and should be treated as hints for user interfaces, not guarantees:
+//   - OperationSet and OperationInstCmd are reported as permitted when the session is authenticated, HELP lists SET or INSTCMD,
+//     and the UPS has writable variables or instant commands. upsd.users may still deny the user those actions, or limit
+//     them to particular commands, in which case the real request fails with ErrAccessDenied.
+//   - OperationFSD is reported as permitted only if the session is already known to be master (u.Master, set by CheckIfMaster).
+//     CheckPermissions never sends FSD, MASTER or PRIMARY to find out.
+func (u *UPS) CheckPermissions(ops []Operation) (map[Operation]bool, error) {
+	permitted := map[Operation]bool{}
+	var serverCommands []string
+	for _, op := range ops {
+		if _, ok := permitted[op]; ok {
+			continue
+		}
+		if (op == OperationSet || op == OperationInstCmd) && serverCommands == nil {
+			resp, err := u.nutClient.SendCommand("HELP")
+			if err != nil {
+				return permitted, err
+			}
+			serverCommands = strings.Fields(strings.TrimPrefix(resp[0], "Commands:"))
+		}
+		var err error
+		switch op {
+		case OperationRead:
+			permitted[op], err = u.canRead()
+		case OperationSet:
+			permitted[op], err = u.canWrite(serverCommands, "SET", "RW")
+		case OperationInstCmd:
+			permitted[op], err = u.canWrite(serverCommands, "INSTCMD", "CMD")
+		case OperationFSD:
+			permitted[op] = u.Master
+		default:
+			err = fmt.Errorf("unknown operation %d", op)
+		}
+		if err != nil {
+			return permitted, err
+		}
+	}
+	return permitted, nil
+}
+
+// canRead probes read access with GET VAR ups.status. Errors about the data rather than access, such as DATA-STALE, still mean upsd allowed the request.
+func (u *UPS) canRead() (bool, error) {
+	_, err := u.getVariableValue("ups.status")
+	switch {
+	case err == nil, errors.Is(err, ErrVarNotSupported), errors.Is(err, ErrDataStale), errors.Is(err, ErrDriverNotConnected):
+		return true, nil
+	case errors.Is(err, ErrAccessDenied):
+		return false, nil
+	}
+	return false, err
+}
+
+// canWrite infers whether serverCommand could succeed: the session must be authenticated, upsd must list serverCommand in HELP,
+// and LIST <listType> must return at least one entry for the UPS.
+func (u *UPS) canWrite(serverCommands []string, serverCommand, listType string) (bool, error) {
+	if !u.nutClient.authenticated || !hasFlag(serverCommands, serverCommand) {
+		return false, nil
+	}
+	resp, err := u.nutClient.SendCommand(fmt.Sprintf("LIST %s %s", listType, u.Name))
+	if errors.Is(err, ErrAccessDenied) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return len(resp) > 2, nil
+}
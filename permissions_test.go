@@ -0,0 +1,42 @@
+package nut
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckPermissions(t *testing.T) {
+	server := newMockServer(t)
+	mock := server.addUPS("ups", "", map[string]string{"ups.status": "OL", "ups.id": "rack"})
+	mock.types = map[string]string{"ups.id": "RW STRING:16"}
+	mock.commands = []string{"beeper.toggle"}
+	ups := testUPS(server, "ups")
+	all := []Operation{OperationRead, OperationSet, OperationInstCmd, OperationFSD}
+
+	permitted, err := ups.CheckPermissions(all)
+	if err != nil {
+		t.Fatalf("CheckPermissions: %v", err)
+	}
+	if !permitted[OperationRead] || permitted[OperationSet] || permitted[OperationInstCmd] || permitted[OperationFSD] {
+		t.Errorf("expected only read to be permitted before authenticating, got %v", permitted)
+	}
+
+	if ok, err := ups.nutClient.Authenticate("monuser", "secret"); err != nil || !ok {
+		t.Fatalf("Authenticate: %v, %v", ok, err)
+	}
+	permitted, err = ups.CheckPermissions(all)
+	if err != nil {
+		t.Fatalf("CheckPermissions: %v", err)
+	}
+	if !permitted[OperationRead] || !permitted[OperationSet] || !permitted[OperationInstCmd] {
+		t.Errorf("expected read, set and instcmd to be permitted after authenticating, got %v", permitted)
+	}
+	if permitted[OperationFSD] {
+		t.Error("expected FSD to be inferred as not permitted without master")
+	}
+	for _, cmd := range server.commands() {
+		if strings.HasPrefix(cmd, "FSD") || strings.HasPrefix(cmd, "MASTER") || strings.HasPrefix(cmd, "PRIMARY") {
+			t.Errorf("CheckPermissions sent %q", cmd)
+		}
+	}
+}
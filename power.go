@@ -0,0 +1,128 @@
+package nut
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// LoadThresholds are the ups.load percentages separating the bands reported by LoadAdvisory.
+type LoadThresholds struct {
+	// UnderUtilized is the load below which the UPS is considered under-utilized.
+	UnderUtilized float64
+	// High is the load at or above which little headroom remains.
+	High float64
+	// Overloaded is the load at or above which the UPS is overloaded.
+	Overloaded float64
+}
+
+// DefaultLoadThresholds are sensible thresholds for LoadAdvisory.
+var DefaultLoadThresholds = LoadThresholds{UnderUtilized: 20, High: 80, Overloaded: 100}
+
+// withDefaults returns t with every zero field replaced by the one from DefaultLoadThresholds.
+func (t LoadThresholds) withDefaults() LoadThresholds {
+	if t.UnderUtilized == 0 {
+		t.UnderUtilized = DefaultLoadThresholds.UnderUtilized
+	}
+	if t.High == 0 {
+		t.High = DefaultLoadThresholds.High
+	}
+	if t.Overloaded == 0 {
+		t.Overloaded = DefaultLoadThresholds.Overloaded
+	}
+	return t
+}
+
+// LoadAdvisory reads ups.load and returns a short advisory describing whether the UPS is under-utilized, optimal, high or overloaded.
+// The advisory starts with the name of the band, e.g. "under-utilized: load is 12%, consider consolidating".
+// Zero fields of thresholds take their value from DefaultLoadThresholds, so LoadThresholds{} means the defaults.
+// Thresholds which are not in ascending order (UnderUtilized < High < Overloaded) are rejected with an error before ups.load is read.
+func (u *UPS) LoadAdvisory(thresholds LoadThresholds) (string, error) {
+	thresholds = thresholds.withDefaults()
+	if thresholds.UnderUtilized >= thresholds.High || thresholds.High >= thresholds.Overloaded {
+		return "", fmt.Errorf("invalid load thresholds %+v: must be ascending", thresholds)
+	}
+	load, err := u.getFloatVariable("ups.load")
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case load >= thresholds.Overloaded:
+		return fmt.Sprintf("overloaded: load is %g%%, reduce the load immediately", load), nil
+	case load >= thresholds.High:
+		return fmt.Sprintf("high: load is %g%%, little headroom remains", load), nil
+	case load < thresholds.UnderUtilized:
+		return fmt.Sprintf("under-utilized: load is %g%%, consider consolidating", load), nil
+	}
+	return fmt.Sprintf("optimal: load is %g%%", load), nil
+}
+
+// GetSensitivity returns the input sensitivity of the UPS (input.sensitivity), typically "low", "normal" or "high".
+func (u *UPS) GetSensitivity() (string, error) {
+	return u.getVariableValue("input.sensitivity")
+}
+
+// SetSensitivity sets input.sensitivity to level after validating it against the variable's ENUM values.
+// An invalid level is rejected without sending a SET to upsd.
+func (u *UPS) SetSensitivity(level string) (bool, error) {
+	if err := u.validateEnum("input.sensitivity", level); err != nil {
+		return false, err
+	}
+	return u.SetVariable("input.sensitivity", level)
+}
+
+// PowerInfo describes the apparent and real power of a UPS. Values the UPS does not report are left at zero.
+type PowerInfo struct {
+	// NominalVA is the rated apparent power (ups.power.nominal).
+	NominalVA float64
+	// VA is the current apparent power, either measured (ups.power) or derived from ups.load × ups.power.nominal.
+	VA float64
+	// VAMeasured is true when VA was read from ups.power.
+	VAMeasured bool
+	// VADerived is true when VA was computed from the load percentage and nominal power.
+	VADerived bool
+	// RealPower is the current real power in watts (ups.realpower).
+	RealPower float64
+	// RealPowerMeasured is true when the UPS reports ups.realpower.
+	RealPowerMeasured bool
+}
+
+// GetPowerInfo returns the nominal and current power of the UPS, deriving the apparent power from the load when ups.power is not reported.
+func (u *UPS) GetPowerInfo() (PowerInfo, error) {
+	info := PowerInfo{}
+	values, err := u.getVariableValues("ups.power.nominal", "ups.power", "ups.realpower", "ups.load")
+	if err != nil {
+		return info, err
+	}
+	numbers := map[string]float64{}
+	for name, value := range values {
+		converted, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return info, fmt.Errorf("invalid value %q for %s: %v", value, name, err)
+		}
+		numbers[name] = converted
+	}
+	info.NominalVA = numbers["ups.power.nominal"]
+	if va, ok := numbers["ups.power"]; ok {
+		info.VA, info.VAMeasured = va, true
+	} else if load, ok := numbers["ups.load"]; ok && info.NominalVA > 0 {
+		info.VA, info.VADerived = load/100*info.NominalVA, true
+	}
+	if realPower, ok := numbers["ups.realpower"]; ok {
+		info.RealPower, info.RealPowerMeasured = realPower, true
+	}
+	return info, nil
+}
+
+// PowerFactor returns the power factor of the load, ups.realpower (W) divided by ups.power (VA).
+// If either variable is missing, or the apparent power is zero, (0, false, nil) is returned.
+func (u *UPS) PowerFactor() (float64, bool, error) {
+	info, err := u.GetPowerInfo()
+	if err != nil {
+		return 0, false, err
+	}
+	if !info.VAMeasured || !info.RealPowerMeasured || info.VA == 0 {
+		return 0, false, nil
+	}
+	return info.RealPower / info.VA, true, nil
+}
@@ -0,0 +1,140 @@
+package nut
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadAdvisory(t *testing.T) {
+	cases := map[string]string{
+		"12":    "under-utilized:",
+		"50":    "optimal:",
+		"85":    "high:",
+		"104.5": "overloaded:",
+	}
+	server := newMockServer(t)
+	for load := range cases {
+		server.addUPS("ups"+load, "", map[string]string{"ups.load": load})
+	}
+	for load, band := range cases {
+		advisory, err := testUPS(server, "ups"+load).LoadAdvisory(DefaultLoadThresholds)
+		if err != nil {
+			t.Fatalf("LoadAdvisory(%s): %v", load, err)
+		}
+		if !strings.HasPrefix(advisory, band) {
+			t.Errorf("load %s: expected %q band, got %q", load, band, advisory)
+		}
+	}
+
+	custom := LoadThresholds{UnderUtilized: 5, High: 40, Overloaded: 90}
+	advisory, err := testUPS(server, "ups50").LoadAdvisory(custom)
+	if err != nil || !strings.HasPrefix(advisory, "high:") {
+		t.Errorf("expected custom thresholds to report high, got %q, %v", advisory, err)
+	}
+
+	// Zero fields fall back to the defaults.
+	advisory, err = testUPS(server, "ups12").LoadAdvisory(LoadThresholds{})
+	if err != nil || !strings.HasPrefix(advisory, "under-utilized:") {
+		t.Errorf("expected zero thresholds to use the defaults, got %q, %v", advisory, err)
+	}
+	advisory, err = testUPS(server, "ups85").LoadAdvisory(LoadThresholds{High: 90})
+	if err != nil || !strings.HasPrefix(advisory, "optimal:") {
+		t.Errorf("expected only the zero fields to use the defaults, got %q, %v", advisory, err)
+	}
+}
+
+func TestLoadAdvisoryRejectsUnorderedThresholds(t *testing.T) {
+	server := newMockServer(t)
+	server.addUPS("ups", "", map[string]string{"ups.load": "10"})
+
+	for _, thresholds := range []LoadThresholds{
+		{UnderUtilized: 50, High: 40, Overloaded: 90},
+		{UnderUtilized: 5, High: 95, Overloaded: 90},
+		{High: 120},
+	} {
+		if advisory, err := testUPS(server, "ups").LoadAdvisory(thresholds); err == nil {
+			t.Errorf("%+v: expected an error, got %q", thresholds, advisory)
+		}
+	}
+	if len(server.commands()) != 0 {
+		t.Errorf("expected no reads for invalid thresholds, got %q", server.commands())
+	}
+}
+
+func TestSensitivity(t *testing.T) {
+	server := newMockServer(t)
+	mock := server.addUPS("ups", "", map[string]string{"input.sensitivity": "normal"})
+	mock.types["input.sensitivity"] = "RW ENUM"
+	mock.enums["input.sensitivity"] = []string{"low", "normal", "high"}
+	ups := testUPS(server, "ups")
+
+	level, err := ups.GetSensitivity()
+	if err != nil || level != "normal" {
+		t.Fatalf("GetSensitivity: %q, %v", level, err)
+	}
+	if ok, err := ups.SetSensitivity("high"); err != nil || !ok {
+		t.Fatalf("SetSensitivity(high): %v, %v", ok, err)
+	}
+	if level, _ := ups.GetSensitivity(); level != "high" {
+		t.Errorf("expected sensitivity to be high after SET, got %q", level)
+	}
+
+	if _, err := ups.SetSensitivity("extreme"); err == nil || !strings.Contains(err.Error(), "low, normal, high") {
+		t.Fatalf("expected extreme to be rejected, got %v", err)
+	}
+	for _, cmd := range server.commands() {
+		if strings.Contains(cmd, "extreme") {
+			t.Errorf("expected invalid level to be rejected locally, but sent %q", cmd)
+		}
+	}
+}
+
+func TestGetPowerInfo(t *testing.T) {
+	server := newMockServer(t)
+	server.addUPS("measured", "", map[string]string{"ups.power.nominal": "1500", "ups.power": "600", "ups.realpower": "540", "ups.load": "40"})
+	server.addUPS("derived", "", map[string]string{"ups.power.nominal": "1000", "ups.load": "25"})
+	server.addUPS("bare", "", map[string]string{"ups.load": "25"})
+
+	info, err := testUPS(server, "measured").GetPowerInfo()
+	if err != nil {
+		t.Fatalf("GetPowerInfo: %v", err)
+	}
+	if info != (PowerInfo{NominalVA: 1500, VA: 600, VAMeasured: true, RealPower: 540, RealPowerMeasured: true}) {
+		t.Errorf("unexpected measured power info: %+v", info)
+	}
+
+	info, err = testUPS(server, "derived").GetPowerInfo()
+	if err != nil {
+		t.Fatalf("GetPowerInfo: %v", err)
+	}
+	if info != (PowerInfo{NominalVA: 1000, VA: 250, VADerived: true}) {
+		t.Errorf("unexpected derived power info: %+v", info)
+	}
+
+	info, err = testUPS(server, "bare").GetPowerInfo()
+	if err != nil {
+		t.Fatalf("GetPowerInfo: %v", err)
+	}
+	if info != (PowerInfo{}) {
+		t.Errorf("expected zero power info without nominal power, got %+v", info)
+	}
+}
+
+func TestPowerFactor(t *testing.T) {
+	server := newMockServer(t)
+	server.addUPS("both", "", map[string]string{"ups.power": "500", "ups.realpower": "450"})
+	server.addUPS("noreal", "", map[string]string{"ups.power": "500"})
+	server.addUPS("nova", "", map[string]string{"ups.realpower": "450", "ups.load": "30", "ups.power.nominal": "1500"})
+	server.addUPS("idle", "", map[string]string{"ups.power": "0", "ups.realpower": "0"})
+
+	factor, ok, err := testUPS(server, "both").PowerFactor()
+	if err != nil || !ok || factor != 0.9 {
+		t.Errorf("expected a power factor of 0.9, got %v, %v, %v", factor, ok, err)
+	}
+	for _, name := range []string{"noreal", "nova", "idle"} {
+		factor, ok, err := testUPS(server, name).PowerFactor()
+		if err != nil || ok || factor != 0 {
+			t.Errorf("%s: expected (0, false, nil), got %v, %v, %v", name, factor, ok, err)
+		}
+	}
+}
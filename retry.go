@@ -0,0 +1,67 @@
+package nut
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy controls how Retry backs off between attempts.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first. Values below 1 mean a single attempt.
+	MaxAttempts int
+	// InitialBackoff is the delay before the second attempt.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between attempts.
+	MaxBackoff time.Duration
+	// Multiplier is applied to the delay after each failed attempt.
+	Multiplier float64
+	// Jitter randomizes each delay by up to this fraction in either direction, e.g. 0.2 for ±20%.
+	Jitter float64
+}
+
+// DefaultRetryPolicy makes up to 5 attempts, backing off exponentially from 100ms to at most 5s with ±20% jitter.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    5,
+	InitialBackoff: 100 * time.Millisecond,
+	MaxBackoff:     5 * time.Second,
+	Multiplier:     2,
+	Jitter:         0.2,
+}
+
+// Retry calls fn until it returns nil, the policy's attempts are exhausted or ctx is done.
+// It returns nil on success, the context's error if ctx ends first, or otherwise the last error returned by fn.
+func Retry(ctx context.Context, policy RetryPolicy, fn func() error) error {
+	backoff := policy.InitialBackoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if err = fn(); err == nil {
+			return nil
+		}
+		if attempt >= policy.MaxAttempts {
+			return err
+		}
+		timer := time.NewTimer(jitter(backoff, policy.Jitter))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		backoff = time.Duration(float64(backoff) * policy.Multiplier)
+		if policy.MaxBackoff > 0 && backoff > policy.MaxBackoff {
+			backoff = policy.MaxBackoff
+		}
+	}
+}
+
+// jitter randomizes d by up to fraction in either direction.
+func jitter(d time.Duration, fraction float64) time.Duration {
+	if fraction <= 0 {
+		return d
+	}
+	return time.Duration(float64(d) * (1 + fraction*(2*rand.Float64()-1)))
+}
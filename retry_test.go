@@ -0,0 +1,64 @@
+package nut
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRetryEventualSuccess(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond, Multiplier: 2, Jitter: 0.5}
+	attempts := 0
+	err := Retry(context.Background(), policy, func() error {
+		attempts++
+		if attempts < 3 {
+			return errors.New("transient")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Retry: %v", err)
+	}
+	if attempts != 3 {
+		t.Errorf("expected 3 attempts, got %d", attempts)
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond, Multiplier: 2}
+	failure := errors.New("permanent")
+	attempts := 0
+	err := Retry(context.Background(), policy, func() error {
+		attempts++
+		return failure
+	})
+	if err != failure || attempts != 2 {
+		t.Errorf("expected the last error after 2 attempts, got %v after %d", err, attempts)
+	}
+}
+
+func TestRetryContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	policy := RetryPolicy{MaxAttempts: 100, InitialBackoff: time.Hour, Multiplier: 2}
+	attempts := 0
+	done := make(chan error)
+	go func() {
+		done <- Retry(ctx, policy, func() error {
+			attempts++
+			return errors.New("transient")
+		})
+	}()
+	cancel()
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Fatalf("expected context.Canceled, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Retry did not return after the context was cancelled")
+	}
+	if attempts > 1 {
+		t.Errorf("expected no attempts after cancellation, got %d", attempts)
+	}
+}
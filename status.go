@@ -0,0 +1,233 @@
+package nut
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// statusFlags returns the space separated flags of ups.status, e.g. ["OB", "LB"].
+func (u *UPS) statusFlags() ([]string, error) {
+	status, err := u.getVariableValue("ups.status")
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(status), nil
+}
+
+// hasFlag reports whether flag is present in flags.
+func hasFlag(flags []string, flag string) bool {
+	for _, f := range flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// validateInterval returns an error if interval cannot be used as a poll interval, which time.NewTicker would panic on.
+func validateInterval(interval time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("invalid poll interval %v: must be positive", interval)
+	}
+	return nil
+}
+
+// waitForStatus polls ups.status every interval, starting immediately, until done returns true for its flags or ctx expires.
+func (u *UPS) waitForStatus(ctx context.Context, interval time.Duration, done func(flags []string) bool) error {
+	if err := validateInterval(interval); err != nil {
+		return err
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		flags, err := u.statusFlags()
+		if err != nil {
+			return err
+		}
+		if done(flags) {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// WaitForOnline polls ups.status every interval until the UPS is back on line power ("OL" present and "OB" absent).
+// It returns nil once the UPS is online, or the context's error if ctx expires first. A non-positive interval is rejected with an error.
+func (u *UPS) WaitForOnline(ctx context.Context, interval time.Duration) error {
+	return u.waitForStatus(ctx, interval, func(flags []string) bool {
+		return hasFlag(flags, "OL") && !hasFlag(flags, "OB")
+	})
+}
+
+// confirmPollInterval is how often ConfirmFSD polls ups.status.
+const confirmPollInterval = 250 * time.Millisecond
+
+// ConfirmFSD polls ups.status until it contains the "FSD" flag, confirming that upsd acted on ForceShutdown rather than only acknowledging it.
+// If the flag does not appear before ctx expires, an error wrapping the context's error is returned.
+func (u *UPS) ConfirmFSD(ctx context.Context) error {
+	err := u.waitForStatus(ctx, confirmPollInterval, func(flags []string) bool {
+		return hasFlag(flags, "FSD")
+	})
+	if err != nil && err == ctx.Err() {
+		return fmt.Errorf("FSD flag never appeared in ups.status for %s: %w", u.Name, err)
+	}
+	return err
+}
+
+// Severity classifies how urgently a UPS condition needs attention.
+type Severity int
+
+// Severities in increasing order of urgency.
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityCritical
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityWarning:
+		return "warning"
+	case SeverityCritical:
+		return "critical"
+	}
+	return "info"
+}
+
+// statusDescriptions are human readable descriptions of the ups.status flags, in the order they are reported in summaries.
+var statusDescriptions = []struct {
+	flag        string
+	description string
+}{
+	{"FSD", "in forced shutdown"},
+	{"OL", "on line power"},
+	{"OB", "on battery"},
+	{"LB", "low on battery"},
+	{"RB", "in need of a battery replacement"},
+	{"OVER", "overloaded"},
+	{"BYPASS", "on bypass"},
+	{"OFF", "with output off"},
+	{"CHRG", "charging"},
+	{"DISCHRG", "discharging"},
+	{"TRIM", "trimming voltage"},
+	{"BOOST", "boosting voltage"},
+	{"CAL", "calibrating"},
+}
+
+// statusSeverity returns the severity of the given ups.status flags and ups.alarm value.
+func statusSeverity(flags []string, alarm string) Severity {
+	switch {
+	case hasFlag(flags, "FSD"), hasFlag(flags, "OVER"), hasFlag(flags, "OB") && hasFlag(flags, "LB"):
+		return SeverityCritical
+	case hasFlag(flags, "OB"), hasFlag(flags, "LB"), hasFlag(flags, "RB"), hasFlag(flags, "BYPASS"), hasFlag(flags, "OFF"), alarm != "":
+		return SeverityWarning
+	}
+	return SeverityInfo
+}
+
+// Notification is an alerting payload describing the current state of a UPS, ready to be serialized for chat or paging systems.
+type Notification struct {
+	UPS      string
+	Severity Severity
+	Summary  string
+	// Highlights holds the variables relevant to the notification, such as ups.status, ups.alarm, battery.charge and battery.runtime.
+	Highlights map[string]string
+}
+
+// notificationHighlights are the variables copied into Notification.Highlights when the UPS reports them.
+var notificationHighlights = []string{"ups.status", "ups.alarm", "battery.charge", "battery.runtime"}
+
+// GetNotification composes a Notification from ups.status and ups.alarm, with the severity derived from the status flags.
+func (u *UPS) GetNotification() (Notification, error) {
+	notification := Notification{UPS: u.Name, Highlights: map[string]string{}}
+	values, err := u.getVariableValues(notificationHighlights...)
+	if err != nil {
+		return notification, err
+	}
+	status, ok := values["ups.status"]
+	if !ok {
+		return notification, ErrVarNotSupported
+	}
+	for _, name := range notificationHighlights {
+		if value, ok := values[name]; ok {
+			notification.Highlights[name] = value
+		}
+	}
+	flags := strings.Fields(status)
+	alarm := values["ups.alarm"]
+	notification.Severity = statusSeverity(flags, alarm)
+
+	descriptions := []string{}
+	for _, s := range statusDescriptions {
+		if hasFlag(flags, s.flag) {
+			descriptions = append(descriptions, s.description)
+		}
+	}
+	if len(descriptions) == 0 {
+		descriptions = append(descriptions, fmt.Sprintf("reporting status %q", status))
+	}
+	notification.Summary = fmt.Sprintf("%s %s is %s", strings.ToUpper(notification.Severity.String()), u.Name, strings.Join(descriptions, ", "))
+	if alarm != "" {
+		notification.Summary += fmt.Sprintf(" (alarm: %s)", alarm)
+	}
+	return notification, nil
+}
+
+// CommunicationStatus classifies the health of the link between upsd, the driver and the UPS.
+type CommunicationStatus int
+
+// Communication states, from healthy to lost.
+const (
+	CommunicationOK CommunicationStatus = iota
+	CommunicationStale
+	CommunicationLost
+)
+
+func (s CommunicationStatus) String() string {
+	switch s {
+	case CommunicationStale:
+		return "stale"
+	case CommunicationLost:
+		return "lost"
+	}
+	return "ok"
+}
+
+// GetCommunicationStatus combines upsd's errors and driver.state into a single communication health signal.
+//
+// CommunicationStale means upsd still has the driver but its data has not been refreshed (DATA-STALE).
+// CommunicationLost means upsd has no connection to the driver (DRIVER-NOT-CONNECTED), the driver is reconnecting to the UPS (driver.state "reconnect"),
+// or ups.status carries the "COMMBAD" or "NOCOMM" flag, which some drivers set while their data is still fresh.
+// The "OFF" flag in ups.status means the UPS output is off, not that communication is lost, and does not affect the result.
+func (u *UPS) GetCommunicationStatus() (CommunicationStatus, error) {
+	flags, err := u.statusFlags()
+	switch {
+	case errors.Is(err, ErrDriverNotConnected):
+		return CommunicationLost, nil
+	case errors.Is(err, ErrDataStale):
+		return CommunicationStale, nil
+	case err != nil:
+		return CommunicationOK, err
+	case hasFlag(flags, "COMMBAD"), hasFlag(flags, "NOCOMM"):
+		return CommunicationLost, nil
+	}
+	state, err := u.DriverState()
+	switch {
+	case errors.Is(err, ErrVarNotSupported):
+		return CommunicationOK, nil
+	case errors.Is(err, ErrDataStale):
+		return CommunicationStale, nil
+	case err != nil:
+		return CommunicationOK, err
+	case state == "reconnect":
+		return CommunicationLost, nil
+	}
+	return CommunicationOK, nil
+}
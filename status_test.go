@@ -0,0 +1,163 @@
+package nut
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// statusSequence returns a mock hook that answers successive GET VAR ups.status requests with statuses,
+// repeating the last one once the sequence is exhausted.
+func statusSequence(upsName string, statuses ...string) func(cmd string) ([]string, bool) {
+	polls := 0
+	return func(cmd string) ([]string, bool) {
+		if cmd != "GET VAR "+upsName+" ups.status" {
+			return nil, false
+		}
+		status := statuses[len(statuses)-1]
+		if polls < len(statuses) {
+			status = statuses[polls]
+		}
+		polls++
+		return []string{`VAR ` + upsName + ` ups.status "` + status + `"`}, true
+	}
+}
+
+func TestWaitForOnline(t *testing.T) {
+	server := newMockServer(t)
+	server.addUPS("ups", "", map[string]string{"ups.status": "OB"})
+	server.hook = statusSequence("ups", "OB DISCHRG", "OB DISCHRG", "OL CHRG")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := testUPS(server, "ups").WaitForOnline(ctx, 10*time.Millisecond); err != nil {
+		t.Fatalf("WaitForOnline: %v", err)
+	}
+	if polls := len(server.commands()); polls != 3 {
+		t.Errorf("expected 3 status polls, got %d", polls)
+	}
+}
+
+func TestWaitForOnlineRejectsInvalidInterval(t *testing.T) {
+	server := newMockServer(t)
+	server.addUPS("ups", "", map[string]string{"ups.status": "OB"})
+
+	for _, interval := range []time.Duration{0, -time.Second} {
+		if err := testUPS(server, "ups").WaitForOnline(context.Background(), interval); err == nil {
+			t.Errorf("expected an error for interval %v", interval)
+		}
+	}
+}
+
+func TestWaitForOnlineContextExpires(t *testing.T) {
+	server := newMockServer(t)
+	server.addUPS("ups", "", map[string]string{"ups.status": "OB"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := testUPS(server, "ups").WaitForOnline(ctx, 10*time.Millisecond); err != context.DeadlineExceeded {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestConfirmFSD(t *testing.T) {
+	server := newMockServer(t)
+	server.addUPS("ups", "", map[string]string{"ups.status": "OB LB"})
+	server.hook = statusSequence("ups", "OB LB", "FSD OB LB")
+	ups := testUPS(server, "ups")
+
+	if ok, err := ups.ForceShutdown(); err != nil || !ok {
+		t.Fatalf("ForceShutdown: %v, %v", ok, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := ups.ConfirmFSD(ctx); err != nil {
+		t.Fatalf("ConfirmFSD: %v", err)
+	}
+}
+
+func TestConfirmFSDNeverSet(t *testing.T) {
+	server := newMockServer(t)
+	server.addUPS("ups", "", map[string]string{"ups.status": "OB LB"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := testUPS(server, "ups").ConfirmFSD(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected an error wrapping context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestGetNotification(t *testing.T) {
+	server := newMockServer(t)
+	server.addUPS("rack1", "", map[string]string{
+		"ups.status":      "OB DISCHRG LB",
+		"battery.charge":  "8",
+		"battery.runtime": "95",
+		"ups.model":       "Smart-UPS 1500",
+	})
+	server.addUPS("rack2", "", map[string]string{"ups.status": "OL CHRG"})
+
+	notification, err := testUPS(server, "rack1").GetNotification()
+	if err != nil {
+		t.Fatalf("GetNotification: %v", err)
+	}
+	if notification.Severity != SeverityCritical {
+		t.Errorf("expected critical severity, got %v", notification.Severity)
+	}
+	if notification.Summary != "CRITICAL rack1 is on battery, low on battery, discharging" {
+		t.Errorf("unexpected summary %q", notification.Summary)
+	}
+	if notification.Highlights["battery.charge"] != "8" || notification.Highlights["battery.runtime"] != "95" {
+		t.Errorf("expected battery highlights, got %v", notification.Highlights)
+	}
+	if _, ok := notification.Highlights["ups.model"]; ok {
+		t.Errorf("did not expect unrelated variables in highlights: %v", notification.Highlights)
+	}
+
+	notification, err = testUPS(server, "rack2").GetNotification()
+	if err != nil {
+		t.Fatalf("GetNotification: %v", err)
+	}
+	if notification.Severity != SeverityInfo {
+		t.Errorf("expected info severity for a charging UPS, got %v", notification.Severity)
+	}
+}
+
+func TestGetCommunicationStatus(t *testing.T) {
+	server := newMockServer(t)
+	server.addUPS("off", "", map[string]string{"ups.status": "OFF", "driver.state": "quiet"})
+	server.addUPS("legacy", "", map[string]string{"ups.status": "OL"})
+	server.addUPS("stale", "", map[string]string{"ups.status": "OL"})
+	server.addUPS("unplugged", "", map[string]string{"ups.status": "OL"})
+	server.addUPS("reconnecting", "", map[string]string{"ups.status": "OL", "driver.state": "reconnect"})
+	server.addUPS("commbad", "", map[string]string{"ups.status": "OL COMMBAD", "driver.state": "quiet"})
+	server.addUPS("nocomm", "", map[string]string{"ups.status": "NOCOMM"})
+	server.hook = func(cmd string) ([]string, bool) {
+		switch cmd {
+		case "GET VAR stale ups.status":
+			return []string{"ERR DATA-STALE"}, true
+		case "GET VAR unplugged ups.status":
+			return []string{"ERR DRIVER-NOT-CONNECTED"}, true
+		}
+		return nil, false
+	}
+
+	for name, expected := range map[string]CommunicationStatus{
+		"off":          CommunicationOK,
+		"legacy":       CommunicationOK,
+		"stale":        CommunicationStale,
+		"unplugged":    CommunicationLost,
+		"reconnecting": CommunicationLost,
+		"commbad":      CommunicationLost,
+		"nocomm":       CommunicationLost,
+	} {
+		status, err := testUPS(server, name).GetCommunicationStatus()
+		if err != nil {
+			t.Errorf("%s: GetCommunicationStatus: %v", name, err)
+		} else if status != expected {
+			t.Errorf("%s: expected %v, got %v", name, expected, status)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package nut
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// StartTLS upgrades the connection to TLS using the STARTTLS command.
+//
+// config may be nil, in which case the server certificate is verified against the system roots using the hostname given to Connect.
+// The client's MinTLSVersion (TLS 1.2 by default) and TLSCipherSuites are enforced on top of config.
+// For mutual TLS, supply the client certificate in config.Certificates. Certificate problems on either side are reported as ErrTLSCertificate.
+// With TLS 1.3 the server checks the client certificate after the handshake completes, so a rejected client certificate
+// surfaces as ErrTLSCertificate from the first command after StartTLS instead.
+// If the handshake fails, for example because the server cannot meet that policy, the connection should be discarded.
+func (c *Client) StartTLS(config *tls.Config) error {
+	tlsConfig := c.tlsConfig(config)
+	resp, err := c.SendCommand("STARTTLS")
+	if err != nil {
+		return err
+	}
+	if resp[0] != "OK STARTTLS" {
+		return fmt.Errorf("unexpected response to STARTTLS: %s", resp[0])
+	}
+	tlsConn := tls.Client(c.conn, tlsConfig)
+	if err := tlsConn.Handshake(); err != nil {
+		if isCertificateError(err) {
+			return fmt.Errorf("%w: %v", ErrTLSCertificate, err)
+		}
+		return fmt.Errorf("TLS handshake failed (minimum version %s): %w", tls.VersionName(tlsConfig.MinVersion), err)
+	}
+	c.conn = tlsConn
+	c.reader = nil
+	return nil
+}
+
+// Encrypted reports whether the session has been upgraded to TLS with StartTLS, so that later commands, including authentication and SET, are sent encrypted.
+func (c *Client) Encrypted() bool {
+	_, ok := c.conn.(*tls.Conn)
+	return ok
+}
+
+// tlsConfig returns a copy of config with the client's TLS policy applied.
+func (c *Client) tlsConfig(config *tls.Config) *tls.Config {
+	if config == nil {
+		config = &tls.Config{}
+	}
+	tlsConfig := config.Clone()
+	minVersion := c.MinTLSVersion
+	if minVersion == 0 {
+		minVersion = tls.VersionTLS12
+	}
+	if tlsConfig.MinVersion < minVersion {
+		tlsConfig.MinVersion = minVersion
+	}
+	if len(c.TLSCipherSuites) > 0 {
+		tlsConfig.CipherSuites = c.TLSCipherSuites
+	}
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = c.host
+		if tlsConfig.ServerName == "" && c.Hostname != nil {
+			tlsConfig.ServerName, _, _ = net.SplitHostPort(c.Hostname.String())
+		}
+	}
+	return tlsConfig
+}
+
+// isCertificateError reports whether err was caused by a certificate being rejected, locally or by the server.
+func isCertificateError(err error) bool {
+	var verificationError *tls.CertificateVerificationError
+	var unknownAuthority x509.UnknownAuthorityError
+	var invalid x509.CertificateInvalidError
+	var hostname x509.HostnameError
+	if errors.As(err, &verificationError) || errors.As(err, &unknownAuthority) || errors.As(err, &invalid) || errors.As(err, &hostname) {
+		return true
+	}
+	// Alerts sent by the server, such as "bad certificate" or "certificate required", are only available as text.
+	var opError *net.OpError
+	return errors.As(err, &opError) && opError.Op == "remote error" && strings.Contains(opError.Err.Error(), "certificate")
+}
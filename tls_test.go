@@ -0,0 +1,165 @@
+package nut
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCertificate returns a self-signed certificate for 127.0.0.1 and a pool trusting it.
+func testCertificate(t *testing.T, commonName string) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parse certificate: %v", err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, pool
+}
+
+func TestStartTLS(t *testing.T) {
+	certificate, pool := testCertificate(t, "upsd")
+	server := newMockServer(t)
+	server.tlsConfig = &tls.Config{Certificates: []tls.Certificate{certificate}}
+	client := server.client()
+
+	if err := client.StartTLS(&tls.Config{RootCAs: pool}); err != nil {
+		t.Fatalf("StartTLS: %v", err)
+	}
+	version, err := client.GetVersion()
+	if err != nil || !strings.HasPrefix(version, "Network UPS Tools") {
+		t.Fatalf("expected VER over TLS to succeed, got %q, %v", version, err)
+	}
+}
+
+func TestRequireTLSForWrites(t *testing.T) {
+	certificate, pool := testCertificate(t, "upsd")
+	server := newMockServer(t)
+	server.tlsConfig = &tls.Config{Certificates: []tls.Certificate{certificate}}
+	mock := server.addUPS("ups", "", map[string]string{"ups.id": "rack"})
+	mock.types = map[string]string{"ups.id": "RW STRING:16"}
+	client := server.client()
+	client.RequireTLSForWrites = true
+	ups := UPS{Name: "ups", nutClient: client}
+
+	if client.Encrypted() {
+		t.Fatal("expected a new session to be unencrypted")
+	}
+	if _, err := ups.SetVariable("ups.id", "plain"); err != ErrInsecureTransport {
+		t.Fatalf("expected ErrInsecureTransport over plaintext, got %v", err)
+	}
+	if _, err := client.SendCommand(" set var ups ups.id plain"); err != ErrInsecureTransport {
+		t.Fatalf("expected a lowercase SET to be refused too, got %v", err)
+	}
+	if len(server.commands()) != 0 {
+		t.Errorf("expected the SET not to be sent, got %q", server.commands())
+	}
+	if _, err := client.GetVersion(); err != nil {
+		t.Errorf("expected reads to be allowed over plaintext, got %v", err)
+	}
+
+	if err := client.StartTLS(&tls.Config{RootCAs: pool}); err != nil {
+		t.Fatalf("StartTLS: %v", err)
+	}
+	if !client.Encrypted() {
+		t.Fatal("expected the session to be encrypted after StartTLS")
+	}
+	if ok, err := ups.SetVariable("ups.id", "secure"); err != nil || !ok {
+		t.Fatalf("expected SET over TLS to succeed, got %v, %v", ok, err)
+	}
+}
+
+func TestStartTLSRejectsOldVersions(t *testing.T) {
+	certificate, pool := testCertificate(t, "upsd")
+	server := newMockServer(t)
+	server.tlsConfig = &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		MinVersion:   tls.VersionTLS10,
+		MaxVersion:   tls.VersionTLS10,
+	}
+	client := server.client()
+
+	// Even if the caller's config allows TLS 1.0, the client's policy must win.
+	err := client.StartTLS(&tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS10})
+	if err == nil {
+		t.Fatal("expected StartTLS to reject a TLS 1.0 only server")
+	}
+	if !strings.Contains(err.Error(), "minimum version TLS 1.2") {
+		t.Errorf("expected the error to name the TLS policy, got %v", err)
+	}
+}
+
+func TestStartTLSNotConfigured(t *testing.T) {
+	server := newMockServer(t)
+	if err := server.client().StartTLS(nil); err != ErrFeatureNotConfigured {
+		t.Fatalf("expected ErrFeatureNotConfigured, got %v", err)
+	}
+}
+
+func TestStartTLSMutual(t *testing.T) {
+	serverCertificate, serverPool := testCertificate(t, "upsd")
+	clientCertificate, clientPool := testCertificate(t, "upsmon")
+	server := newMockServer(t)
+	server.tlsConfig = &tls.Config{
+		Certificates: []tls.Certificate{serverCertificate},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientPool,
+	}
+
+	client := server.client()
+	if err := client.StartTLS(&tls.Config{RootCAs: serverPool, Certificates: []tls.Certificate{clientCertificate}}); err != nil {
+		t.Fatalf("StartTLS with a client certificate: %v", err)
+	}
+	if _, err := client.GetVersion(); err != nil {
+		t.Fatalf("VER over mutual TLS: %v", err)
+	}
+
+	// Under TLS 1.3 the rejection arrives after the handshake, so accept it from either step.
+	client = server.client()
+	err := client.StartTLS(&tls.Config{RootCAs: serverPool})
+	if err == nil {
+		_, err = client.GetVersion()
+	}
+	if !errors.Is(err, ErrTLSCertificate) {
+		t.Fatalf("expected ErrTLSCertificate without a client certificate, got %v", err)
+	}
+}
+
+func TestStartTLSUntrustedServer(t *testing.T) {
+	serverCertificate, _ := testCertificate(t, "upsd")
+	_, otherPool := testCertificate(t, "other")
+	server := newMockServer(t)
+	server.tlsConfig = &tls.Config{Certificates: []tls.Certificate{serverCertificate}}
+
+	if err := server.client().StartTLS(&tls.Config{RootCAs: otherPool}); !errors.Is(err, ErrTLSCertificate) {
+		t.Fatalf("expected ErrTLSCertificate for an untrusted server, got %v", err)
+	}
+}
@@ -1,10 +1,13 @@
 package nut
 
 import (
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
-	"regexp"
+	"time"
 )
 
 // UPS contains information about a specific UPS provided by the NUT instance.
@@ -17,6 +20,7 @@ type UPS struct {
 	Variables      []Variable
 	Commands       []Command
 	nutClient      *Client
+	commandsLoaded bool
 }
 
 // Variable describes a single variable related to a UPS.
@@ -42,27 +46,30 @@ func NewUPS(name string, client *Client) (UPS, error) {
 		Name:      name,
 		nutClient: client,
 	}
-	_, err := newUPS.GetClients()
+	_, err := newUPS.GetDescription()
 	if err != nil {
 		return newUPS, err
 	}
-	_, err = newUPS.GetCommands()
+	err = newUPS.load()
+	return newUPS, err
+}
+
+// load fills in everything about the UPS except its description: clients, commands, number of logins and variables.
+func (u *UPS) load() error {
+	_, err := u.GetClients()
 	if err != nil {
-		return newUPS, err
+		return err
 	}
-	_, err = newUPS.GetDescription()
+	_, err = u.GetCommands()
 	if err != nil {
-		return newUPS, err
+		return err
 	}
-	_, err = newUPS.GetNumberOfLogins()
+	_, err = u.GetNumberOfLogins()
 	if err != nil {
-		return newUPS, err
+		return err
 	}
-	_, err = newUPS.GetVariables()
-	if err != nil {
-		return newUPS, err
-	}
-	return newUPS, err
+	_, err = u.GetVariables()
+	return err
 }
 
 // GetNumberOfLogins returns the number of clients which have done LOGIN for this UPS.
@@ -94,6 +101,31 @@ func (u *UPS) GetClients() ([]string, error) {
 	return clientsList, nil
 }
 
+// ClientAuditReport compares the clients connected to a UPS with its login count.
+type ClientAuditReport struct {
+	Clients        []string
+	NumberOfLogins int
+	// Mismatch is true when the number of clients differs from NumberOfLogins, which can indicate stale sessions.
+	Mismatch bool
+}
+
+// ClientAudit returns the clients of the UPS (LIST CLIENT) alongside its login count (GET NUMLOGINS), flagging any disagreement.
+func (u *UPS) ClientAudit() (ClientAuditReport, error) {
+	report := ClientAuditReport{}
+	clients, err := u.GetClients()
+	if err != nil {
+		return report, err
+	}
+	numberOfLogins, err := u.GetNumberOfLogins()
+	if err != nil {
+		return report, err
+	}
+	report.Clients = clients
+	report.NumberOfLogins = numberOfLogins
+	report.Mismatch = len(clients) != numberOfLogins
+	return report, nil
+}
+
 // CheckIfMaster returns true if the session is authenticated with the master permission set.
 func (u *UPS) CheckIfMaster() (bool, error) {
 	resp, err := u.nutClient.SendCommand(fmt.Sprintf("MASTER %s", u.Name))
@@ -119,6 +151,8 @@ func (u *UPS) GetDescription() (string, error) {
 }
 
 // GetVariables returns a slice of Variable structs for the UPS.
+// All values are read with a single LIST VAR, which is as batched as NUT allows; there is no per-variable fallback,
+// since without LIST VAR the names of the variables are not known. The description and type of each variable take one GET DESC and one GET TYPE.
 func (u *UPS) GetVariables() ([]Variable, error) {
 	vars := []Variable{}
 	resp, err := u.nutClient.SendCommand(fmt.Sprintf("LIST VAR %s", u.Name))
@@ -146,6 +180,7 @@ func (u *UPS) GetVariables() ([]Variable, error) {
 		newVar.Type = varType
 		newVar.Writeable = writeable
 		newVar.MaximumLength = maximumLength
+		newVar.Name = u.nutClient.variableName(newVar.Name)
 
 		if splitLine[1] == "enabled" {
 			newVar.Value = true
@@ -187,6 +222,135 @@ func (u *UPS) GetVariables() ([]Variable, error) {
 	return vars, nil
 }
 
+// getRawVariables returns the variable names (in the order reported by upsd) and their unconverted values.
+// Unlike GetVariables it issues a single LIST VAR and does not query descriptions or types.
+func (u *UPS) getRawVariables() ([]string, map[string]string, error) {
+	names := []string{}
+	values := map[string]string{}
+	resp, err := u.nutClient.SendCommand(fmt.Sprintf("LIST VAR %s", u.Name))
+	if err != nil {
+		return names, values, err
+	}
+	offset := fmt.Sprintf("VAR %s ", u.Name)
+	for _, line := range resp[1 : len(resp)-1] {
+		name, value := parseVariableLine(strings.TrimPrefix(line, offset))
+		name = u.nutClient.variableName(name)
+		names = append(names, name)
+		values[name] = value
+	}
+	return names, values, nil
+}
+
+// NamespaceVariables returns the unconverted values of all variables in the dotted namespace prefix, e.g. "ups.display" matches "ups.display.language" but not "ups.displaymode".
+// It issues a single LIST VAR, so any vendor namespace can be read without a dedicated helper. An empty map is returned if nothing matches.
+func (u *UPS) NamespaceVariables(prefix string) (map[string]string, error) {
+	namespace := map[string]string{}
+	_, values, err := u.getRawVariables()
+	if err != nil {
+		return namespace, err
+	}
+	prefix = strings.TrimSuffix(prefix, ".")
+	for name, value := range values {
+		if name == prefix || strings.HasPrefix(name, prefix+".") {
+			namespace[name] = value
+		}
+	}
+	return namespace, nil
+}
+
+// getVariableValue returns the unconverted value of a single variable using GET VAR.
+// If the UPS does not provide the variable, ErrVarNotSupported is returned.
+func (u *UPS) getVariableValue(variableName string) (string, error) {
+	resp, err := u.nutClient.SendCommand(fmt.Sprintf("GET VAR %s %s", u.Name, variableName))
+	if err != nil {
+		return "", err
+	}
+	_, value := parseVariableLine(strings.TrimPrefix(resp[0], fmt.Sprintf("VAR %s ", u.Name)))
+	return value, nil
+}
+
+// getVariableValues returns the unconverted values of several variables, omitting those the UPS does not provide.
+//
+// NUT has no multi-variable GET, so when more than one variable is requested a single LIST VAR is used and filtered.
+// If the server rejects LIST VAR as unknown, invalid or unsupported (as some proxies do), it falls back to one GET VAR per variable.
+// It backs the helpers which read a known set of variables, such as GetFirmwareInfo, GetPowerInfo and GetNotification;
+// GetVariables lists every variable and does not use it.
+func (u *UPS) getVariableValues(variableNames ...string) (map[string]string, error) {
+	values := map[string]string{}
+	if len(variableNames) > 1 {
+		_, all, err := u.getRawVariables()
+		if err == nil {
+			for _, name := range variableNames {
+				if value, ok := all[name]; ok {
+					values[name] = value
+				}
+			}
+			return values, nil
+		}
+		if err != ErrUnknownCommand && err != ErrInvalidArgument && err != ErrFeatureNotSupported {
+			return values, err
+		}
+	}
+	for _, name := range variableNames {
+		value, err := u.getVariableValue(name)
+		if err == ErrVarNotSupported {
+			continue
+		}
+		if err != nil {
+			return values, err
+		}
+		values[name] = value
+	}
+	return values, nil
+}
+
+// getFloatVariable returns the value of a single numeric variable.
+func (u *UPS) getFloatVariable(variableName string) (float64, error) {
+	value, err := u.getVariableValue(variableName)
+	if err != nil {
+		return 0, err
+	}
+	converted, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q for %s: %v", value, variableName, err)
+	}
+	return converted, nil
+}
+
+// GetVariableDecoded returns the value of variableName decoded using encoding, which must be "base64" or "hex".
+// This is intended for the opaque diagnostic payloads exposed by some vendor drivers.
+func (u *UPS) GetVariableDecoded(variableName, encoding string) ([]byte, error) {
+	value, err := u.getVariableValue(variableName)
+	if err != nil {
+		return nil, err
+	}
+	var decoded []byte
+	switch strings.ToLower(encoding) {
+	case "base64":
+		decoded, err = base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+	case "hex":
+		decoded, err = hex.DecodeString(strings.TrimSpace(value))
+	default:
+		return nil, fmt.Errorf("unsupported encoding %q", encoding)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("malformed %s value for %s: %v", encoding, variableName, err)
+	}
+	return decoded, nil
+}
+
+// parseVariableLine splits `name "value"` into its name and unescaped value.
+func parseVariableLine(line string) (string, string) {
+	splitLine := strings.SplitN(line, " ", 2)
+	if len(splitLine) < 2 {
+		return splitLine[0], ""
+	}
+	value := strings.TrimSuffix(strings.TrimPrefix(splitLine[1], `"`), `"`)
+	value = strings.Replace(value, `\"`, `"`, -1)
+	value = strings.Replace(value, `\\`, `\`, -1)
+	return splitLine[0], value
+}
+
 // GetVariableDescription returns a string that gives a brief explanation for the given variableName.
 // upsd may return "Unavailable" if the file which provides this description is not installed.
 func (u *UPS) GetVariableDescription(variableName string) (string, error) {
@@ -226,7 +390,40 @@ func (u *UPS) GetVariableType(variableName string) (string, bool, int, error) {
 	return varType, writeable, maximumLength, nil
 }
 
-// GetCommands returns a slice of Command structs for the UPS.
+// GetEnumValues returns the values allowed for an ENUM variable using LIST ENUM.
+func (u *UPS) GetEnumValues(variableName string) ([]string, error) {
+	values := []string{}
+	resp, err := u.nutClient.SendCommand(fmt.Sprintf("LIST ENUM %s %s", u.Name, variableName))
+	if err != nil {
+		return values, err
+	}
+	offset := fmt.Sprintf("ENUM %s ", u.Name)
+	for _, line := range resp[1 : len(resp)-1] {
+		_, value := parseVariableLine(strings.TrimPrefix(line, offset))
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// validateEnum checks value against the ENUM values of variableName before it is SET.
+// Variables without any ENUM values accept any value.
+func (u *UPS) validateEnum(variableName, value string) error {
+	allowed, err := u.GetEnumValues(variableName)
+	if err != nil {
+		return err
+	}
+	if len(allowed) == 0 {
+		return nil
+	}
+	for _, a := range allowed {
+		if a == value {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid value %q for %s, expected one of: %s", value, variableName, strings.Join(allowed, ", "))
+}
+
+// GetCommands returns a slice of Command structs for the UPS, always querying upsd and refreshing the cache used by CachedCommands.
 func (u *UPS) GetCommands() ([]Command, error) {
 	commandsList := []Command{}
 	resp, err := u.nutClient.SendCommand(fmt.Sprintf("LIST CMD %s", u.Name))
@@ -234,36 +431,65 @@ func (u *UPS) GetCommands() ([]Command, error) {
 		return commandsList, err
 	}
 	linePrefix := fmt.Sprintf("CMD %s ", u.Name)
+	cmdNames := []string{}
+	queries := []string{}
 	for _, line := range resp[1 : len(resp)-1] {
 		cmdName := strings.TrimPrefix(line, linePrefix)
-		cmd := Command{
-			Name: cmdName,
-		}
-		description, err := u.GetCommandDescription(cmdName)
-		if err != nil {
-			return commandsList, err
+		cmdNames = append(cmdNames, cmdName)
+		queries = append(queries, fmt.Sprintf("GET CMDDESC %s %s", u.Name, cmdName))
+	}
+	// The descriptions are fetched in one pipelined batch rather than a round trip per command.
+	descriptions, errs, err := u.nutClient.sendPipelined(queries)
+	if err != nil {
+		return commandsList, err
+	}
+	for i, cmdName := range cmdNames {
+		if errs[i] != nil {
+			return commandsList, errs[i]
 		}
-		cmd.Description = description
-		commandsList = append(commandsList, cmd)
+		commandsList = append(commandsList, Command{
+			Name:        cmdName,
+			Description: u.parseCommandDescription(cmdName, descriptions[i]),
+		})
 	}
 	u.Commands = commandsList
+	u.commandsLoaded = true
 	return commandsList, nil
 }
 
+// CachedCommands returns the UPS's commands and their descriptions, querying upsd only the first time.
+// The result is a snapshot taken during this session and is not updated if the driver's command set changes; call GetCommands to refresh it.
+// A UPS returned by NewUPS already has its commands cached.
+func (u *UPS) CachedCommands() ([]Command, error) {
+	if u.commandsLoaded {
+		return u.Commands, nil
+	}
+	return u.GetCommands()
+}
+
 // GetCommandDescription returns a string that gives a brief explanation for the given commandName.
 func (u *UPS) GetCommandDescription(commandName string) (string, error) {
 	resp, err := u.nutClient.SendCommand(fmt.Sprintf("GET CMDDESC %s %s", u.Name, commandName))
 	if err != nil {
 		return "", err
 	}
-	trimmedLine := strings.TrimPrefix(resp[0], fmt.Sprintf("CMDDESC %s %s ", u.Name, commandName))
-	description := strings.Replace(trimmedLine, `"`, "", -1)
-	return description, err
+	return u.parseCommandDescription(commandName, resp[0]), nil
+}
+
+// parseCommandDescription extracts the description from a CMDDESC reply line.
+func (u *UPS) parseCommandDescription(commandName, line string) string {
+	trimmedLine := strings.TrimPrefix(line, fmt.Sprintf("CMDDESC %s %s ", u.Name, commandName))
+	return strings.Replace(trimmedLine, `"`, "", -1)
 }
 
 // SetVariable sets the given variableName to the given value on the UPS.
+// The value is quoted and escaped with BuildCommand; a value containing a line break is rejected without being sent.
 func (u *UPS) SetVariable(variableName, value string) (bool, error) {
-	resp, err := u.nutClient.SendCommand(fmt.Sprintf(`SET VAR %s %s "%s"`, u.Name, variableName, value))
+	cmd, err := BuildCommand("SET", "VAR", u.Name, variableName, value)
+	if err != nil {
+		return false, err
+	}
+	resp, err := u.nutClient.SendCommand(cmd)
 	if err != nil {
 		return false, err
 	}
@@ -304,3 +530,49 @@ func (u *UPS) ForceShutdown() (bool, error) {
 	}
 	return false, nil
 }
+
+// CoordinatedShutdown performs an orderly shutdown of the UPS in three steps: it sets ups.delay.shutdown to shutdownDelay,
+// sets ups.delay.start to restoreDelay if it is non-zero, and then sends the "shutdown.return" instant command so that
+// the load is restored when line power returns.
+//
+// Both delays must be whole, non-negative numbers of seconds, and the UPS must support shutdown.return; these are checked before anything is sent.
+// If any step fails the sequence stops there and the shutdown command is not sent. Changes already made are not rolled back.
+func (u *UPS) CoordinatedShutdown(shutdownDelay, restoreDelay time.Duration) error {
+	for _, delay := range []time.Duration{shutdownDelay, restoreDelay} {
+		if delay < 0 || delay%time.Second != 0 {
+			return fmt.Errorf("invalid shutdown delay %v: must be a whole, non-negative number of seconds", delay)
+		}
+	}
+	supported, err := u.supportsCommand("shutdown.return")
+	if err != nil {
+		return err
+	}
+	if !supported {
+		return ErrCmdNotSupported
+	}
+
+	variableNames := []string{"ups.delay.shutdown"}
+	delays := []time.Duration{shutdownDelay}
+	if restoreDelay > 0 {
+		variableNames = append(variableNames, "ups.delay.start")
+		delays = append(delays, restoreDelay)
+	}
+	for i, variableName := range variableNames {
+		ok, err := u.SetVariable(variableName, strconv.Itoa(int(delays[i]/time.Second)))
+		if err != nil {
+			return fmt.Errorf("error setting %s, shutdown not sent: %w", variableName, err)
+		}
+		if !ok {
+			return fmt.Errorf("upsd did not accept SET of %s, shutdown not sent", variableName)
+		}
+	}
+
+	ok, err := u.SendCommand("shutdown.return")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("upsd did not accept shutdown.return for %s", u.Name)
+	}
+	return nil
+}
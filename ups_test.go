@@ -0,0 +1,189 @@
+package nut
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testUPS returns a UPS bound to a fresh connection to server, without the queries done by NewUPS.
+func testUPS(server *mockServer, name string) *UPS {
+	return &UPS{Name: name, nutClient: server.client()}
+}
+
+func TestGetVariableDecoded(t *testing.T) {
+	server := newMockServer(t)
+	server.addUPS("ups", "", map[string]string{
+		"vendor.blob.b64": "aGVsbG8=",
+		"vendor.blob.hex": "68656c6c6f",
+		"vendor.blob.bad": "not*valid",
+	})
+	ups := testUPS(server, "ups")
+
+	for name, encoding := range map[string]string{"vendor.blob.b64": "base64", "vendor.blob.hex": "hex"} {
+		decoded, err := ups.GetVariableDecoded(name, encoding)
+		if err != nil {
+			t.Fatalf("GetVariableDecoded(%s, %s): %v", name, encoding, err)
+		}
+		if string(decoded) != "hello" {
+			t.Errorf("%s: expected hello, got %q", name, decoded)
+		}
+	}
+	for _, encoding := range []string{"base64", "hex"} {
+		if _, err := ups.GetVariableDecoded("vendor.blob.bad", encoding); err == nil || !strings.Contains(err.Error(), "malformed") {
+			t.Errorf("%s: expected a malformed value error, got %v", encoding, err)
+		}
+	}
+}
+
+func TestGetVariableValuesBatched(t *testing.T) {
+	server := newMockServer(t)
+	server.addUPS("ups", "", map[string]string{"ups.load": "40", "ups.power": "600", "ups.model": "X"})
+
+	values, err := testUPS(server, "ups").getVariableValues("ups.load", "ups.power", "ups.realpower")
+	if err != nil {
+		t.Fatalf("getVariableValues: %v", err)
+	}
+	if len(values) != 2 || values["ups.load"] != "40" || values["ups.power"] != "600" {
+		t.Errorf("unexpected values %v", values)
+	}
+	if received := server.commands(); len(received) != 1 || received[0] != "LIST VAR ups" {
+		t.Errorf("expected a single LIST VAR, got %q", received)
+	}
+}
+
+func TestGetVariableValuesFallback(t *testing.T) {
+	server := newMockServer(t)
+	server.addUPS("ups", "", map[string]string{"ups.load": "40", "ups.power": "600"})
+	server.hook = func(cmd string) ([]string, bool) {
+		if strings.HasPrefix(cmd, "LIST VAR ") {
+			return []string{"ERR UNKNOWN-COMMAND"}, true
+		}
+		return nil, false
+	}
+
+	values, err := testUPS(server, "ups").getVariableValues("ups.load", "ups.power", "ups.realpower")
+	if err != nil {
+		t.Fatalf("getVariableValues: %v", err)
+	}
+	if len(values) != 2 || values["ups.load"] != "40" || values["ups.power"] != "600" {
+		t.Errorf("unexpected values %v", values)
+	}
+	expected := []string{"LIST VAR ups", "GET VAR ups ups.load", "GET VAR ups ups.power", "GET VAR ups ups.realpower"}
+	if received := server.commands(); strings.Join(received, "|") != strings.Join(expected, "|") {
+		t.Errorf("expected fallback to GET VAR, got %q", received)
+	}
+}
+
+func TestClientAudit(t *testing.T) {
+	server := newMockServer(t)
+	consistent := server.addUPS("consistent", "", nil)
+	consistent.clients = []string{"10.0.0.1", "10.0.0.2"}
+	consistent.numLogins = 2
+	stale := server.addUPS("stale", "", nil)
+	stale.clients = []string{"10.0.0.1"}
+	stale.numLogins = 3
+
+	report, err := testUPS(server, "consistent").ClientAudit()
+	if err != nil {
+		t.Fatalf("ClientAudit: %v", err)
+	}
+	if report.Mismatch || report.NumberOfLogins != 2 || len(report.Clients) != 2 {
+		t.Errorf("unexpected report %+v", report)
+	}
+
+	report, err = testUPS(server, "stale").ClientAudit()
+	if err != nil {
+		t.Fatalf("ClientAudit: %v", err)
+	}
+	if !report.Mismatch || report.NumberOfLogins != 3 || len(report.Clients) != 1 || report.Clients[0] != "10.0.0.1" {
+		t.Errorf("expected a mismatch to be flagged, got %+v", report)
+	}
+}
+
+func TestCoordinatedShutdown(t *testing.T) {
+	server := newMockServer(t)
+	mock := server.addUPS("ups", "", map[string]string{"ups.delay.shutdown": "20", "ups.delay.start": "30"})
+	mock.types = map[string]string{"ups.delay.shutdown": "RW NUMBER", "ups.delay.start": "RW NUMBER"}
+	mock.commands = []string{"shutdown.return"}
+
+	if err := testUPS(server, "ups").CoordinatedShutdown(60*time.Second, 120*time.Second); err != nil {
+		t.Fatalf("CoordinatedShutdown: %v", err)
+	}
+	expected := []string{
+		"LIST CMD ups",
+		"SET VAR ups ups.delay.shutdown 60",
+		"SET VAR ups ups.delay.start 120",
+		"INSTCMD ups shutdown.return",
+	}
+	if received := server.commands(); strings.Join(received, "|") != strings.Join(expected, "|") {
+		t.Errorf("unexpected command sequence %q", received)
+	}
+}
+
+func TestCoordinatedShutdownAbortsOnFailedDelay(t *testing.T) {
+	server := newMockServer(t)
+	mock := server.addUPS("ups", "", map[string]string{"ups.delay.shutdown": "20"})
+	mock.types = map[string]string{"ups.delay.shutdown": "NUMBER"}
+	mock.commands = []string{"shutdown.return"}
+
+	err := testUPS(server, "ups").CoordinatedShutdown(60*time.Second, 0)
+	if !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("expected ErrReadOnly, got %v", err)
+	}
+	for _, cmd := range server.commands() {
+		if strings.HasPrefix(cmd, "INSTCMD") {
+			t.Errorf("shutdown command sent after a failed delay: %q", cmd)
+		}
+	}
+
+	if err := testUPS(server, "ups").CoordinatedShutdown(1500*time.Millisecond, 0); err == nil {
+		t.Error("expected an error for a fractional delay")
+	}
+}
+
+func TestCachedCommands(t *testing.T) {
+	server := newMockServer(t)
+	mock := server.addUPS("ups", "", nil)
+	mock.commands = []string{"beeper.toggle", "test.battery.start"}
+	ups := testUPS(server, "ups")
+
+	for i := 0; i < 2; i++ {
+		commands, err := ups.CachedCommands()
+		if err != nil {
+			t.Fatalf("CachedCommands: %v", err)
+		}
+		if len(commands) != 2 || commands[0].Name != "beeper.toggle" {
+			t.Errorf("unexpected commands %+v", commands)
+		}
+	}
+	listed := 0
+	for _, cmd := range server.commands() {
+		if cmd == "LIST CMD ups" {
+			listed++
+		}
+	}
+	if listed != 1 {
+		t.Errorf("expected a single LIST CMD, got %d", listed)
+	}
+}
+
+func TestNamespaceVariables(t *testing.T) {
+	server := newMockServer(t)
+	server.addUPS("ups", "", map[string]string{
+		"ups.display.language": "en",
+		"ups.display.contrast": "4",
+		"ups.displaymode":      "full",
+		"ups.load":             "40",
+		"device.model":         "X",
+	})
+
+	namespace, err := testUPS(server, "ups").NamespaceVariables("ups.display")
+	if err != nil {
+		t.Fatalf("NamespaceVariables: %v", err)
+	}
+	if len(namespace) != 2 || namespace["ups.display.language"] != "en" || namespace["ups.display.contrast"] != "4" {
+		t.Errorf("unexpected namespace %v", namespace)
+	}
+}
@@ -0,0 +1,237 @@
+package nut
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// DebouncedWatch polls ups.status every interval and emits the status on the returned channel only once it has stayed the same for at least stableFor.
+// Transient flaps, such as rapid OL/OB transitions during a brownout, are suppressed. The first settled status is always emitted.
+//
+// Polling stops when ctx is done or a poll fails; in the latter case the error is sent on the error channel. Both channels are then closed.
+// A non-positive interval is reported the same way, without polling.
+// The UPS's client must not be used for other commands while the watch is running.
+func (u *UPS) DebouncedWatch(ctx context.Context, interval, stableFor time.Duration) (<-chan string, <-chan error) {
+	statuses := make(chan string)
+	errs := make(chan error, 1)
+	if err := validateInterval(interval); err != nil {
+		errs <- err
+		close(errs)
+		close(statuses)
+		return statuses, errs
+	}
+	go func() {
+		defer close(errs)
+		defer close(statuses)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		var candidate, emitted string
+		var candidateSince time.Time
+		polled, hasEmitted := false, false
+		for {
+			status, err := u.getVariableValue("ups.status")
+			if err != nil {
+				errs <- err
+				return
+			}
+			now := u.nutClient.clock()
+			if !polled || status != candidate {
+				candidate, candidateSince, polled = status, now, true
+			}
+			if (!hasEmitted || candidate != emitted) && now.Sub(candidateSince) >= stableFor {
+				select {
+				case statuses <- candidate:
+				case <-ctx.Done():
+					return
+				}
+				emitted, hasEmitted = candidate, true
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return statuses, errs
+}
+
+// UPSListChange describes UPSes which appeared in or disappeared from LIST UPS between two polls.
+type UPSListChange struct {
+	Added   []string
+	Removed []string
+}
+
+// WatchUPSList polls LIST UPS every interval and emits a UPSListChange whenever UPSes are added or removed.
+// The first poll establishes the baseline and does not produce an event.
+//
+// Polling stops when ctx is done or a poll fails; in the latter case the error is sent on the error channel. Both channels are then closed.
+// A non-positive interval is reported the same way, without polling.
+// The client must not be used for other commands while the watch is running.
+func (c *Client) WatchUPSList(ctx context.Context, interval time.Duration) (<-chan UPSListChange, <-chan error) {
+	changes := make(chan UPSListChange)
+	errs := make(chan error, 1)
+	if err := validateInterval(interval); err != nil {
+		errs <- err
+		close(errs)
+		close(changes)
+		return changes, errs
+	}
+	go func() {
+		defer close(errs)
+		defer close(changes)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		var known map[string]bool
+		for {
+			names, err := c.upsNames()
+			if err != nil {
+				errs <- err
+				return
+			}
+			current := map[string]bool{}
+			change := UPSListChange{}
+			for _, name := range names {
+				current[name] = true
+				if known != nil && !known[name] {
+					change.Added = append(change.Added, name)
+				}
+			}
+			for name := range known {
+				if !current[name] {
+					change.Removed = append(change.Removed, name)
+				}
+			}
+			sort.Strings(change.Removed)
+			known = current
+			if len(change.Added) > 0 || len(change.Removed) > 0 {
+				select {
+				case changes <- change:
+				case <-ctx.Done():
+					return
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return changes, errs
+}
+
+// OverflowPolicy selects what ConsolidatedFeed does when its buffer is full.
+type OverflowPolicy int
+
+// Overflow policies for ConsolidatedFeed.
+const (
+	// OverflowBlock pauses polling until the consumer makes room, so no event is lost but events are delayed.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDrop discards new events while the buffer is full and keeps polling. The number discarded is reported in UPSEvent.Dropped.
+	OverflowDrop
+)
+
+// UPSEvent is a change of ups.status, or of its availability, reported by ConsolidatedFeed.
+type UPSEvent struct {
+	UPS    string
+	Status string
+	// Err is set, and Status is empty, when ups.status of this UPS could not be read, for example ErrDataStale.
+	// The feed keeps polling the UPS and reports its status again once it can be read.
+	Err error
+	// Dropped is the number of states which were lost under OverflowDrop since the previous event was delivered:
+	// states which could not be delivered before the UPS moved on to another one. A state which is re-sent and delivered later is not counted.
+	Dropped int
+}
+
+// feedState is what ConsolidatedFeed last delivered for a UPS.
+type feedState struct {
+	status string
+	err    string
+}
+
+// ConsolidatedFeed polls ups.status of every UPS in LIST UPS every interval and emits a UPSEvent on a single channel whenever a status changes,
+// including the first status seen for each UPS. A UPS whose status cannot be read is reported with UPSEvent.Err set and does not stop the feed.
+// The channel buffers up to bufferSize events; policy decides what happens when it is full.
+// With OverflowDrop, an event which does not fit is discarded and retried on the next poll if the UPS is still in that state,
+// so a consumer which falls behind eventually sees the current state of every UPS, though not every intermediate one.
+//
+// Polling stops when ctx is done or LIST UPS fails; in the latter case the error is sent on the error channel. Both channels are then closed.
+// A non-positive interval is reported the same way, without polling.
+// The client must not be used for other commands while the feed is running.
+func (c *Client) ConsolidatedFeed(ctx context.Context, interval time.Duration, bufferSize int, policy OverflowPolicy) (<-chan UPSEvent, <-chan error) {
+	if bufferSize < 0 {
+		bufferSize = 0
+	}
+	events := make(chan UPSEvent, bufferSize)
+	errs := make(chan error, 1)
+	if err := validateInterval(interval); err != nil {
+		errs <- err
+		close(errs)
+		close(events)
+		return events, errs
+	}
+	go func() {
+		defer close(errs)
+		defer close(events)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		delivered := map[string]feedState{}
+		// pending holds, per UPS, a state which did not fit into the channel and is retried on the next poll.
+		pending := map[string]feedState{}
+		dropped := 0
+		for {
+			names, err := c.upsNames()
+			if err != nil {
+				errs <- err
+				return
+			}
+			for _, name := range names {
+				ups := UPS{Name: name, nutClient: c}
+				event := UPSEvent{UPS: name}
+				state := feedState{}
+				event.Status, event.Err = ups.getVariableValue("ups.status")
+				if event.Err != nil {
+					event.Status = ""
+					state.err = event.Err.Error()
+				}
+				state.status = event.Status
+				if lost, ok := pending[name]; ok && lost != state {
+					dropped++
+					delete(pending, name)
+				}
+				if previous, ok := delivered[name]; ok && previous == state {
+					continue
+				}
+				if policy == OverflowDrop {
+					event.Dropped = dropped
+					select {
+					case events <- event:
+						delivered[name] = state
+						delete(pending, name)
+						dropped = 0
+					default:
+						pending[name] = state
+					}
+					continue
+				}
+				select {
+				case events <- event:
+					delivered[name] = state
+				case <-ctx.Done():
+					return
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return events, errs
+}
@@ -0,0 +1,273 @@
+package nut
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDebouncedWatch(t *testing.T) {
+	server := newMockServer(t)
+	server.addUPS("ups", "", map[string]string{"ups.status": "OL"})
+	server.hook = statusSequence("ups",
+		"OL", "OL", "OL", "OL",
+		"OB", "OL", "OB", "OL",
+		"OB", "OB", "OB", "OB",
+	)
+	ups := testUPS(server, "ups")
+	// Each poll reads the clock once, so every poll is 10ms apart regardless of scheduling.
+	ups.nutClient.now = (&fakeClock{step: 10 * time.Millisecond}).now
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	statuses, errs := ups.DebouncedWatch(ctx, time.Millisecond, 25*time.Millisecond)
+
+	for _, expected := range []string{"OL", "OB"} {
+		select {
+		case status := <-statuses:
+			if status != expected {
+				t.Fatalf("expected settled status %q, got %q", expected, status)
+			}
+		case err := <-errs:
+			t.Fatalf("DebouncedWatch: %v", err)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %q", expected)
+		}
+	}
+	select {
+	case status := <-statuses:
+		t.Fatalf("expected no further transitions, got %q", status)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestDebouncedWatchRejectsInvalidInterval(t *testing.T) {
+	server := newMockServer(t)
+	server.addUPS("ups", "", map[string]string{"ups.status": "OL"})
+
+	statuses, errs := testUPS(server, "ups").DebouncedWatch(context.Background(), 0, time.Second)
+	if err := <-errs; err == nil {
+		t.Error("expected an error for a zero interval")
+	}
+	if _, ok := <-statuses; ok {
+		t.Error("expected the status channel to be closed")
+	}
+	if len(server.commands()) != 0 {
+		t.Errorf("expected no polls, got %q", server.commands())
+	}
+}
+
+func TestWatchUPSList(t *testing.T) {
+	server := newMockServer(t)
+	server.addUPS("alpha", "", nil)
+	server.addUPS("beta", "", nil)
+	client := server.client()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes, errs := client.WatchUPSList(ctx, 5*time.Millisecond)
+
+	// Wait for the baseline poll before changing the list.
+	deadline := time.Now().Add(5 * time.Second)
+	for len(server.commands()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	server.addUPS("gamma", "", nil)
+
+	next := func() UPSListChange {
+		select {
+		case change := <-changes:
+			return change
+		case err := <-errs:
+			t.Fatalf("WatchUPSList: %v", err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for a change")
+		}
+		return UPSListChange{}
+	}
+	change := next()
+	if len(change.Added) != 1 || change.Added[0] != "gamma" || len(change.Removed) != 0 {
+		t.Errorf("expected gamma to be added, got %+v", change)
+	}
+
+	server.removeUPS("alpha")
+	change = next()
+	if len(change.Removed) != 1 || change.Removed[0] != "alpha" || len(change.Added) != 0 {
+		t.Errorf("expected alpha to be removed, got %+v", change)
+	}
+}
+
+func TestWatchUPSListRejectsInvalidInterval(t *testing.T) {
+	server := newMockServer(t)
+
+	changes, errs := server.client().WatchUPSList(context.Background(), -time.Second)
+	if err := <-errs; err == nil {
+		t.Error("expected an error for a negative interval")
+	}
+	if _, ok := <-changes; ok {
+		t.Error("expected the change channel to be closed")
+	}
+}
+
+// flappingStatus returns a mock hook that answers every GET VAR ups.status for upsName with a status different from the previous one.
+func flappingStatus(upsName string) func(cmd string) ([]string, bool) {
+	polls := 0
+	return func(cmd string) ([]string, bool) {
+		if cmd != "GET VAR "+upsName+" ups.status" {
+			return nil, false
+		}
+		polls++
+		status := "OL"
+		if polls%2 == 0 {
+			status = "OB"
+		}
+		return []string{`VAR ` + upsName + ` ups.status "` + status + `"`}, true
+	}
+}
+
+// statusPolls counts the GET VAR ups.status commands received by server.
+func statusPolls(server *mockServer) int {
+	polls := 0
+	for _, cmd := range server.commands() {
+		if strings.HasSuffix(cmd, " ups.status") {
+			polls++
+		}
+	}
+	return polls
+}
+
+func TestConsolidatedFeedRejectsInvalidInterval(t *testing.T) {
+	server := newMockServer(t)
+
+	events, errs := server.client().ConsolidatedFeed(context.Background(), 0, 1, OverflowDrop)
+	if err := <-errs; err == nil {
+		t.Error("expected an error for a zero interval")
+	}
+	if _, ok := <-events; ok {
+		t.Error("expected the event channel to be closed")
+	}
+}
+
+func TestConsolidatedFeedDrop(t *testing.T) {
+	server := newMockServer(t)
+	server.addUPS("ups", "", map[string]string{"ups.status": "OL"})
+	server.hook = flappingStatus("ups")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, errs := server.client().ConsolidatedFeed(ctx, time.Millisecond, 2, OverflowDrop)
+
+	// A consumer which is too slow: the buffer fills and later events are dropped while polling continues.
+	time.Sleep(100 * time.Millisecond)
+	if polls := statusPolls(server); polls <= 3 {
+		t.Fatalf("expected polling to continue while the buffer is full, got %d polls", polls)
+	}
+	for i, expected := range []string{"OL", "OB"} {
+		event := <-events
+		if event.UPS != "ups" || event.Status != expected || event.Dropped != 0 {
+			t.Fatalf("buffered event %d: expected %s with nothing dropped, got %+v", i, expected, event)
+		}
+	}
+	select {
+	case event := <-events:
+		if event.Dropped == 0 {
+			t.Errorf("expected the first event after the overflow to report dropped events, got %+v", event)
+		}
+	case err := <-errs:
+		t.Fatalf("ConsolidatedFeed: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for an event after the overflow")
+	}
+}
+
+func TestConsolidatedFeedBlock(t *testing.T) {
+	server := newMockServer(t)
+	server.addUPS("ups", "", map[string]string{"ups.status": "OL"})
+	server.hook = flappingStatus("ups")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, _ := server.client().ConsolidatedFeed(ctx, time.Millisecond, 1, OverflowBlock)
+
+	// One event fills the buffer and the next blocks the poller, so polling stops until the consumer catches up.
+	time.Sleep(100 * time.Millisecond)
+	if polls := statusPolls(server); polls != 2 {
+		t.Fatalf("expected polling to block after 2 polls, got %d", polls)
+	}
+	for i, expected := range []string{"OL", "OB", "OL"} {
+		event := <-events
+		if event.Status != expected || event.Dropped != 0 {
+			t.Fatalf("event %d: expected %s with nothing dropped, got %+v", i, expected, event)
+		}
+	}
+}
+
+func TestConsolidatedFeedResendsDroppedChange(t *testing.T) {
+	server := newMockServer(t)
+	server.addUPS("ups", "", map[string]string{"ups.status": "OL"})
+	server.hook = statusSequence("ups", "OL", "OB")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, _ := server.client().ConsolidatedFeed(ctx, time.Millisecond, 1, OverflowDrop)
+
+	// The OL→OB change is dropped while OL fills the buffer, and must still be delivered once there is room.
+	time.Sleep(50 * time.Millisecond)
+	if event := <-events; event.Status != "OL" {
+		t.Fatalf("expected OL first, got %+v", event)
+	}
+	select {
+	case event := <-events:
+		if event.Status != "OB" || event.Dropped != 0 {
+			t.Errorf("expected the OB change to be re-sent and not counted as lost, got %+v", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the dropped change to be re-sent")
+	}
+}
+
+func TestConsolidatedFeedReportsUPSErrors(t *testing.T) {
+	server := newMockServer(t)
+	server.addUPS("alpha", "", map[string]string{"ups.status": "OL"})
+	server.addUPS("stale", "", map[string]string{"ups.status": "OL"})
+	stale := true
+	var mu sync.Mutex
+	server.hook = func(cmd string) ([]string, bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		if cmd == "GET VAR stale ups.status" && stale {
+			return []string{"ERR DATA-STALE"}, true
+		}
+		return nil, false
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, errs := server.client().ConsolidatedFeed(ctx, time.Millisecond, 10, OverflowBlock)
+
+	next := func() UPSEvent {
+		select {
+		case event := <-events:
+			return event
+		case err := <-errs:
+			t.Fatalf("expected the feed to keep running, got %v", err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for an event")
+		}
+		return UPSEvent{}
+	}
+	if event := next(); event.UPS != "alpha" || event.Status != "OL" || event.Err != nil {
+		t.Fatalf("unexpected first event %+v", event)
+	}
+	if event := next(); event.UPS != "stale" || event.Err != ErrDataStale || event.Status != "" {
+		t.Fatalf("expected the stale UPS to be reported with its error, got %+v", event)
+	}
+	mu.Lock()
+	stale = false
+	mu.Unlock()
+	if event := next(); event.UPS != "stale" || event.Status != "OL" || event.Err != nil {
+		t.Errorf("expected the UPS to be reported again once it recovers, got %+v", event)
+	}
+}